@@ -1,37 +1,240 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"log"
 	"os"
 
 	"github.com/Mekambee/Swift-Codes-Api/internal/api"
+	"github.com/Mekambee/Swift-Codes-Api/internal/config"
 	"github.com/Mekambee/Swift-Codes-Api/internal/database"
+	"github.com/Mekambee/Swift-Codes-Api/internal/repository"
+	"github.com/Mekambee/Swift-Codes-Api/internal/services"
 )
 
+// Usage:
+//
+//	main                       start the API server
+//	main migrate [up]          apply all pending migrations
+//	main migrate down [N]      roll back the last N migrations (default 1)
+//	main migrate status        list migrations and whether they are applied
+//	main repair-headquarters [--dry-run]
+//	                           fix isHeadquarter flags contradicting their code
 func main() {
+	cfg := config.Load()
 
-	dbHost := os.Getenv("DB_HOST")
-	dbUser := os.Getenv("DB_USER")
-	dbPass := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-	dbPort := os.Getenv("DB_PORT")
-
-	if dbHost == "" {
-		dbHost = "localhost"
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v\n", err)
+		}
+		return
 	}
-	if dbPort == "" {
-		dbPort = "5432"
+	if len(os.Args) > 1 && os.Args[1] == "repair-headquarters" {
+		if err := runRepairHeadquarters(cfg, os.Args[2:]); err != nil {
+			log.Fatalf("Repair failed: %v\n", err)
+		}
+		return
 	}
 
-	err := database.ConnectAndMigrate(dbHost, dbUser, dbPass, dbName, dbPort)
+	db, err := openDB(cfg)
 	if err != nil {
 		log.Fatalf("Cannot connect to DB: %v\n", err)
 	}
-	defer database.DB.Close()
+	defer db.Close()
+
+	if err := prepareSchema(cfg, db); err != nil {
+		log.Fatalf("Cannot migrate DB: %v\n", err)
+	}
+
+	readOnly := cfg.DBDriver == config.DriverSQLite && cfg.SQLiteReadOnly
+	service := services.NewSwiftService(newRepository(cfg, db))
+	service.SetReadOnly(readOnly)
+
+	aliases, err := services.ParseColumnMapping(cfg.ImportColumnAliases)
+	if err != nil {
+		log.Fatalf("Invalid IMPORT_COLUMN_ALIASES: %v\n", err)
+	}
+	service.SetColumnAliases(aliases)
+	if err := service.SetMaxLookupCodes(cfg.LookupMaxCodes); err != nil {
+		log.Fatalf("Invalid LOOKUP_MAX_CODES: %v\n", err)
+	}
+	if err := service.SetMaxImportBytes(int64(cfg.ImportMaxBodyMB) << 20); err != nil {
+		log.Fatalf("Invalid IMPORT_MAX_BODY_MB: %v\n", err)
+	}
 
-	router := api.SetupRouter()
+	if cfg.InstanceID != "" {
+		service.SetInstanceID(cfg.InstanceID)
+	}
+	// A read-only database runs no imports, and cannot mark any as failed.
+	if !readOnly {
+		if failed, err := service.RecoverImports(); err != nil {
+			log.Printf("Cannot check for interrupted imports: %v\n", err)
+		} else if failed > 0 {
+			log.Printf("Marked %d import(s) interrupted by the last shutdown as failed\n", failed)
+		}
+		go service.WatchImports(context.Background())
+	}
+
+	router := api.SetupRouter(service)
 	log.Println("Starting server on :8080")
 	if err := router.Run(":8080"); err != nil {
 		log.Fatalf("Server failed: %v\n", err)
 	}
 }
+
+// openDB connects to the storage backend selected by cfg.DBDriver.
+func openDB(cfg config.Config) (*sql.DB, error) {
+	switch cfg.DBDriver {
+	case config.DriverPostgres:
+		return database.ConnectPostgres(cfg.DBHost, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBPort)
+	case config.DriverSQLite:
+		log.Printf("Using SQLite database %s (read-only: %t)\n", cfg.SQLitePath, cfg.SQLiteReadOnly)
+		return database.ConnectSQLite(cfg.SQLitePath, cfg.SQLiteReadOnly)
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q", cfg.DBDriver)
+	}
+}
+
+func newRepository(cfg config.Config, db *sql.DB) repository.SwiftCodeRepository {
+	if cfg.DBDriver == config.DriverSQLite {
+		return repository.NewSQLiteRepository(db)
+	}
+	return repository.NewPostgresRepository(db)
+}
+
+// prepareSchema applies pending migrations, or only reports them when
+// MIGRATE_ON_START is off. Read-only SQLite files are left alone.
+func prepareSchema(cfg config.Config, db *sql.DB) error {
+	if cfg.DBDriver == config.DriverSQLite && cfg.SQLiteReadOnly {
+		return nil
+	}
+
+	migrator, err := database.NewMigrator(db, cfg.DBDriver)
+	if err != nil {
+		return err
+	}
+
+	if !cfg.MigrateOnStart {
+		pending, err := migrator.Pending()
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			log.Printf("%d pending migration(s), run the migrate command to apply them\n", pending)
+		}
+		return nil
+	}
+
+	applied, err := migrator.Up()
+	for _, m := range applied {
+		log.Printf("Applied migration %04d_%s\n", m.Version, m.Name)
+	}
+	return err
+}
+
+func runMigrate(cfg config.Config, args []string) error {
+	if cfg.DBDriver == config.DriverSQLite && cfg.SQLiteReadOnly {
+		return fmt.Errorf("cannot migrate a read-only SQLite database")
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db, cfg.DBDriver)
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if _, err := fmt.Sscanf(args[1], "%d", &steps); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Unknown {
+				state += " (unknown to this binary)"
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q (use up, down [N] or status)", command)
+	}
+}
+
+// runRepairHeadquarters lists the stored codes whose isHeadquarter flag
+// contradicts their XXX suffix and, without --dry-run, fixes them.
+func runRepairHeadquarters(cfg config.Config, args []string) error {
+	dryRun := false
+	for _, arg := range args {
+		if arg != "--dry-run" {
+			return fmt.Errorf("unknown argument %q (use --dry-run)", arg)
+		}
+		dryRun = true
+	}
+	if cfg.DBDriver == config.DriverSQLite && cfg.SQLiteReadOnly && !dryRun {
+		return fmt.Errorf("cannot repair a read-only SQLite database")
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	service := services.NewSwiftService(newRepository(cfg, db))
+	mismatches, err := service.RepairHeadquarters(dryRun)
+	if err != nil {
+		return err
+	}
+	for _, sc := range mismatches {
+		stored, derived := "branch", "headquarter"
+		if sc.IsHeadquarter {
+			stored, derived = derived, stored
+		}
+		fmt.Printf("%-11s stored as %s, should be %s\n", sc.SwiftCode, stored, derived)
+	}
+
+	if dryRun {
+		fmt.Printf("%d record(s) to repair\n", len(mismatches))
+	} else {
+		fmt.Printf("repaired %d record(s)\n", len(mismatches))
+	}
+	return nil
+}
@@ -1,74 +1,409 @@
 package api
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/Mekambee/Swift-Codes-Api/internal/countries"
 	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/Mekambee/Swift-Codes-Api/internal/repository"
 	"github.com/Mekambee/Swift-Codes-Api/internal/services"
+	"github.com/Mekambee/Swift-Codes-Api/internal/validation"
 	"github.com/gin-gonic/gin"
 )
 
-// Endpoint 1: GET /v1/swift-codes/{swiftCode}
-func GetSwiftCodeHandler(c *gin.Context) {
-	swiftCode := c.Param("swiftCode")
+// Handler serves the HTTP endpoints on top of a SwiftService.
+type Handler struct {
+	service *services.SwiftService
+}
 
-	sc, err := services.GetSwiftCode(swiftCode)
-	if err != nil {
+func NewHandler(service *services.SwiftService) *Handler {
+	return &Handler{service: service}
+}
+
+// writeHandler returns handler, or when the database is read-only a handler
+// refusing the request with 503 before it reaches the storage.
+func (h *Handler) writeHandler(handler gin.HandlerFunc) gin.HandlerFunc {
+	if !h.service.ReadOnly() {
+		return handler
+	}
+	return func(c *gin.Context) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "The database is read-only (SQLITE_READ_ONLY), writes are disabled"})
+	}
+}
+
+// Endpoint 1: GET /v1/swift-codes/{swiftCode}
+// The code is matched ignoring case and surrounding spaces, and an 8-character
+// code resolves to its XXX headquarter; "lookup" tells which form matched.
+func (h *Handler) GetSwiftCodeHandler(c *gin.Context) {
+	sc, match, err := h.service.LookupSwiftCode(c.Param("swiftCode"))
+	if errors.Is(err, repository.ErrNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Swift code not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve data"})
+		return
+	}
 
+	c.Header("ETag", etag(sc.Version))
+
+	var branches []models.SwiftCodeData
 	if sc.IsHeadquarter {
-		branches, err := services.GetBranchesByHQ(swiftCode)
+		branches, err = h.service.GetBranchesByHQ(sc.SwiftCode)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve branches"})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{
-			"address":       sc.Address,
-			"bankName":      sc.BankName,
-			"countryISO2":   sc.CountryISO2,
-			"countryName":   sc.CountryName,
-			"isHeadquarter": sc.IsHeadquarter,
-			"swiftCode":     sc.SwiftCode,
-			"branches":      branches,
-		})
-		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, swiftCodeResponse(sc, match, branches))
+}
+
+// swiftCodeResponse is the body of GET /v1/swift-codes/{swiftCode}: the
+// record, how it was matched and, when not nil, its branches.
+func swiftCodeResponse(sc *models.SwiftCodeData, match models.CodeMatch, branches []models.SwiftCodeData) gin.H {
+	resp := gin.H{
 		"address":       sc.Address,
+		"town":          sc.Town,
+		"postalCode":    sc.PostalCode,
 		"bankName":      sc.BankName,
 		"countryISO2":   sc.CountryISO2,
 		"countryName":   sc.CountryName,
 		"isHeadquarter": sc.IsHeadquarter,
 		"swiftCode":     sc.SwiftCode,
-	})
+		"codeType":      sc.CodeType,
+		"timeZone":      sc.TimeZone,
+		"lookup":        match,
+	}
+	// Where the data came from, when it was last written by an import.
+	if sc.ImportID != "" {
+		resp["importId"] = sc.ImportID
+		resp["sourceRow"] = sc.SourceRow
+	}
+
+	if branches != nil {
+		resp["branches"] = branches
+	}
+	return resp
+}
+
+// Endpoint: POST /v1/swift-codes/lookup
+/*
+{
+"swiftCodes": [string],
+"includeBranches": bool
+}
+*/
+type LookupSwiftCodesRequest struct {
+	SwiftCodes []string `json:"swiftCodes" binding:"required"`
+	// IncludeBranches adds the branches of headquarters, as GET /v1/swift-codes/{swiftCode} does.
+	IncludeBranches bool `json:"includeBranches"`
+}
+
+// LookupSwiftCodesHandler looks up many codes with one query. Found codes are
+// listed in the shape of GetSwiftCodeHandler, the others as they were sent,
+// both in request order.
+func (h *Handler) LookupSwiftCodesHandler(c *gin.Context) {
+	var req LookupSwiftCodesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := h.service.LookupSwiftCodes(req.SwiftCodes, req.IncludeBranches)
+	if errors.Is(err, services.ErrTooManyCodes) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve data"})
+		return
+	}
+
+	found := []gin.H{}
+	notFound := []string{}
+	for _, result := range results {
+		if result.Code == nil {
+			notFound = append(notFound, result.Match.Requested)
+			continue
+		}
+		found = append(found, swiftCodeResponse(result.Code, result.Match, result.Branches))
+	}
+	c.JSON(http.StatusOK, gin.H{"found": found, "notFound": notFound})
 }
 
-// Endpoint 2: GET /v1/swift-codes/country/{countryISO2}
-func GetByCountryHandler(c *gin.Context) {
+// Endpoint 2: GET /v1/swift-codes/country/{countryISO2}?codeType=&timeZone=&town=&headquartersOnly=&limit=&cursor=
+// Records are ordered by SWIFT code. Sending limit or cursor pages them:
+// nextCursor, when present, is passed as cursor to get the next page. Without
+// either, the whole country is returned at once, as before paging existed.
+// With headquartersOnly only headquarters are listed, each with its number of
+// branches.
+func (h *Handler) GetByCountryHandler(c *gin.Context) {
 	iso2 := c.Param("countryISO2")
 	iso2 = strings.ToUpper(iso2)
 
-	data, err := services.GetSwiftByCountryISO2(iso2)
+	filter := repository.CountryFilter{
+		CodeType: models.NormalizeCodeType(c.Query("codeType")),
+		TimeZone: strings.TrimSpace(c.Query("timeZone")),
+		Town:     models.NormalizeTown(c.Query("town")),
+	}
+	paged := c.Query("limit") != "" || c.Query("cursor") != ""
+	limit, err := queryInt(c, "limit", defaultCountryLimit, 1, maxCountryLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	after, err := decodeCursor(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	headquartersOnly := false
+	if raw := c.Query("headquartersOnly"); raw != "" {
+		if headquartersOnly, err = strconv.ParseBool(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("headquartersOnly must be true or false, got %q", raw)})
+			return
+		}
+	}
+
+	// One record more than the limit tells whether there is a next page.
+	page := repository.CountryPage{After: after}
+	if paged {
+		page.Limit = limit + 1
+	}
+	var (
+		records interface{}
+		codes   []models.SwiftCodeData
+		more    bool
+	)
+	if headquartersOnly {
+		var headquarters []models.Headquarter
+		headquarters, err = h.service.GetCountryHeadquarters(iso2, filter, page)
+		if more = paged && len(headquarters) > limit; more {
+			headquarters = headquarters[:limit]
+		}
+		for _, hq := range headquarters {
+			codes = append(codes, hq.SwiftCodeData)
+		}
+		records = headquarters
+	} else {
+		codes, err = h.service.GetSwiftByCountryISO2(iso2, filter, page)
+		if more = paged && len(codes) > limit; more {
+			codes = codes[:limit]
+		}
+		records = codes
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve data"})
 		return
 	}
-	if len(data) == 0 {
+	if len(codes) == 0 && after == "" {
 		c.JSON(http.StatusNotFound, gin.H{"error": "No records found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	storedName := ""
+	if len(codes) > 0 {
+		storedName = codes[0].CountryName
+	}
+	resp := gin.H{
 		"countryISO2": iso2,
-		"countryName": data[0].CountryName,
-		"swiftCodes":  data,
+		"countryName": countries.Name(iso2, storedName),
+		"swiftCodes":  records,
+	}
+	if more {
+		resp["nextCursor"] = encodeCursor(codes[len(codes)-1].SwiftCode)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+const (
+	defaultCountryLimit = 100
+	maxCountryLimit     = 1000
+)
+
+// encodeCursor turns the last code of a page into an opaque cursor.
+func encodeCursor(lastCode string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(lastCode))
+}
+
+// decodeCursor returns the last code of the previous page, or "" for none.
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	lastCode, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(lastCode) == 0 {
+		return "", fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return string(lastCode), nil
+}
+
+// Endpoint: GET /v1/swift-codes/country/{countryISO2}/tree
+// Returns the whole country with branches nested under their headquarters
+// and the branches without one under "orphans".
+func (h *Handler) GetCountryTreeHandler(c *gin.Context) {
+	tree, err := h.service.CountryTree(strings.ToUpper(c.Param("countryISO2")))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No records found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve data"})
+		return
+	}
+	c.JSON(http.StatusOK, tree)
+}
+
+// Endpoint: GET /v1/swift-codes?bankName=&town=&countryISO2=&isHeadquarter=&codePrefix=&codeType=&sort=&limit=&offset=
+// Filters combine. countryISO2 may be repeated or comma-separated, and sort is
+// a comma-separated list of fields, each descending when prefixed with "-".
+func (h *Handler) SearchSwiftCodesHandler(c *gin.Context) {
+	q, err := searchQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, total, err := h.service.SearchSwiftCodes(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve data"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"swiftCodes": page,
+		"total":      total,
+		"limit":      q.Limit,
+		"offset":     q.Offset,
 	})
 }
 
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+// searchQuery reads the query parameters of SearchSwiftCodesHandler.
+func searchQuery(c *gin.Context) (repository.SearchQuery, error) {
+	q := repository.SearchQuery{
+		BankName:   strings.TrimSpace(c.Query("bankName")),
+		Town:       models.NormalizeTown(c.Query("town")),
+		CodePrefix: models.NormalizeSwiftCode(c.Query("codePrefix")),
+		CodeType:   models.NormalizeCodeType(c.Query("codeType")),
+	}
+	var err error
+	if q.Countries, err = queryCountries(c); err != nil {
+		return q, err
+	}
+	if raw := c.Query("isHeadquarter"); raw != "" {
+		isHQ, err := strconv.ParseBool(raw)
+		if err != nil {
+			return q, fmt.Errorf("isHeadquarter must be true or false, got %q", raw)
+		}
+		q.IsHeadquarter = &isHQ
+	}
+	for _, field := range strings.Split(c.Query("sort"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key := repository.SortKey{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+		if !repository.IsSortField(key.Field) {
+			return q, fmt.Errorf("cannot sort by %q", key.Field)
+		}
+		q.Sort = append(q.Sort, key)
+	}
+
+	if q.Limit, err = queryInt(c, "limit", defaultSearchLimit, 1, maxSearchLimit); err != nil {
+		return q, err
+	}
+	q.Offset, err = queryInt(c, "offset", 0, 0, math.MaxInt32)
+	return q, err
+}
+
+// Endpoint: GET /v1/swift-codes/search?q=&countryISO2=&minScore=&limit=
+// Ranks codes by how well their bank name and address match q, ignoring case
+// and diacritics, and returns them best first with their score.
+func (h *Handler) FuzzySearchHandler(c *gin.Context) {
+	q := repository.FuzzyQuery{Text: strings.TrimSpace(c.Query("q")), MinScore: defaultMinScore}
+	if q.Text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q must not be empty"})
+		return
+	}
+	if len(q.Text) > maxFuzzyTextLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("q must be at most %d characters", maxFuzzyTextLength)})
+		return
+	}
+	countries, err := queryCountries(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	q.Countries = countries
+	if raw := c.Query("minScore"); raw != "" {
+		q.MinScore, err = strconv.ParseFloat(raw, 64)
+		if err != nil || q.MinScore <= 0 || q.MinScore > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "minScore must be a number above 0 and at most 1"})
+			return
+		}
+	}
+	if q.Limit, err = queryInt(c, "limit", defaultFuzzyLimit, 1, maxFuzzyLimit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := h.service.FuzzySearch(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"query": q.Text, "results": results})
+}
+
+const (
+	defaultMinScore    = 0.3
+	defaultFuzzyLimit  = 20
+	maxFuzzyLimit      = 100
+	maxFuzzyTextLength = 255
+)
+
+// queryCountries reads the countryISO2 query parameter, repeated or
+// comma-separated, and checks every code against the ISO 3166 reference.
+func queryCountries(c *gin.Context) ([]string, error) {
+	var result []string
+	for _, value := range c.QueryArray("countryISO2") {
+		for _, iso2 := range strings.Split(value, ",") {
+			iso2 = strings.ToUpper(strings.TrimSpace(iso2))
+			if iso2 == "" {
+				continue
+			}
+			if _, ok := countries.Lookup(iso2); !ok {
+				return nil, errors.New(errUnknownCountry(iso2))
+			}
+			result = append(result, iso2)
+		}
+	}
+	return result, nil
+}
+
+// Endpoint: GET /v1/countries
+// Lists the countries with stored codes and their number of headquarters and branches.
+func (h *Handler) ListCountriesHandler(c *gin.Context) {
+	summaries, err := h.service.ListCountries()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"countries": summaries})
+}
+
 // Endpoint 3: POST /v1/swift-codes/
 /*
 {
@@ -78,26 +413,55 @@ func GetByCountryHandler(c *gin.Context) {
 "countryName": string,
 “isHeadquarter”: bool,
 "swiftCode": string,
+"codeType": string,
+"timeZone": string,
+"town": string,
+"postalCode": string
 }
 */
 type CreateSwiftCodeRequest struct {
-	Address       string `json:"address" binding:"required"`
-	BankName      string `json:"bankName" binding:"required"`
-	CountryISO2   string `json:"countryISO2" binding:"required"`
-	CountryName   string `json:"countryName" binding:"required"`
-	IsHeadquarter bool   `json:"isHeadquarter"`
+	Address     string `json:"address" binding:"required"`
+	BankName    string `json:"bankName" binding:"required"`
+	CountryISO2 string `json:"countryISO2" binding:"required"`
+	// CountryName is optional and replaced by the ISO 3166 name of CountryISO2.
+	CountryName string `json:"countryName"`
+	// IsHeadquarter is optional, derived from the code; when sent it must agree.
+	IsHeadquarter *bool  `json:"isHeadquarter"`
 	SwiftCode     string `json:"swiftCode" binding:"required"`
+	// CodeType, TimeZone, Town and PostalCode are optional.
+	CodeType   string `json:"codeType"`
+	TimeZone   string `json:"timeZone"`
+	Town       string `json:"town"`
+	PostalCode string `json:"postalCode"`
 }
 
-func CreateSwiftCodeHandler(c *gin.Context) {
+func (h *Handler) CreateSwiftCodeHandler(c *gin.Context) {
 	var req CreateSwiftCodeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	req.SwiftCode = models.NormalizeSwiftCode(req.SwiftCode)
 	req.CountryISO2 = strings.ToUpper(req.CountryISO2)
 	req.CountryName = strings.ToUpper(req.CountryName)
+	if _, ok := countries.Lookup(req.CountryISO2); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errUnknownCountry(req.CountryISO2)})
+		return
+	}
+	if failures := validation.ValidateBIC(req.SwiftCode, req.CountryISO2); len(failures) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid SWIFT code", "failures": failures})
+		return
+	}
+	if !models.ValidTimeZone(req.TimeZone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errUnknownTimeZone(req.TimeZone)})
+		return
+	}
+	isHQ, err := services.HeadquarterFlag(req.SwiftCode, req.IsHeadquarter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	sc := models.SwiftCodeData{
 		SwiftCode:     req.SwiftCode,
@@ -105,10 +469,14 @@ func CreateSwiftCodeHandler(c *gin.Context) {
 		Address:       req.Address,
 		CountryISO2:   req.CountryISO2,
 		CountryName:   req.CountryName,
-		IsHeadquarter: req.IsHeadquarter,
+		IsHeadquarter: isHQ,
+		CodeType:      models.NormalizeCodeType(req.CodeType),
+		TimeZone:      req.TimeZone,
+		Town:          models.NormalizeTown(req.Town),
+		PostalCode:    models.NormalizePostalCode(req.PostalCode),
 	}
 
-	err := services.SaveSwiftCodes([]models.SwiftCodeData{sc})
+	err = h.service.SaveSwiftCodes([]models.SwiftCodeData{sc})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save data"})
 		return
@@ -117,6 +485,48 @@ func CreateSwiftCodeHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Swift code created"})
 }
 
+// Endpoint: POST /v1/swift-codes/validate
+/*
+{
+"swiftCode": string,
+"countryISO2": string
+}
+*/
+type ValidateSwiftCodeRequest struct {
+	SwiftCode string `json:"swiftCode" binding:"required"`
+	// CountryISO2 is optional; when sent, the SWIFT code's country must match it.
+	CountryISO2 string `json:"countryISO2"`
+}
+
+// ValidateSwiftCodeHandler checks a SWIFT code without storing anything and
+// lists every check it failed.
+func (h *Handler) ValidateSwiftCodeHandler(c *gin.Context) {
+	var req ValidateSwiftCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	swiftCode := models.NormalizeSwiftCode(req.SwiftCode)
+	failures := validation.ValidateBIC(swiftCode, req.CountryISO2)
+	if failures == nil {
+		failures = []validation.Failure{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"swiftCode": swiftCode,
+		"valid":     len(failures) == 0,
+		"failures":  failures,
+	})
+}
+
+func errUnknownCountry(iso2 string) string {
+	return fmt.Sprintf("unknown countryISO2 %q, expected an ISO 3166-1 alpha-2 code", iso2)
+}
+
+func errUnknownTimeZone(name string) string {
+	return fmt.Sprintf("unknown time zone %q, expected an IANA name such as Europe/Warsaw", name)
+}
+
 // Endpoint 4: DELETE /v1/swift-codes/{swiftCode}
 /*
 {
@@ -129,7 +539,7 @@ type DeleteSwiftCodeRequest struct {
 	CountryISO2 string `json:"countryISO2"`
 }
 
-func DeleteSwiftCodeHandler(c *gin.Context) {
+func (h *Handler) DeleteSwiftCodeHandler(c *gin.Context) {
 	swiftCode := c.Param("swiftCode")
 
 	var req DeleteSwiftCodeRequest
@@ -140,10 +550,14 @@ func DeleteSwiftCodeHandler(c *gin.Context) {
 
 	req.CountryISO2 = strings.ToUpper(req.CountryISO2)
 
-	err := services.DeleteSwiftCode(swiftCode, req.BankName, req.CountryISO2)
-	if err != nil {
+	err := h.service.DeleteSwiftCode(swiftCode, req.BankName, req.CountryISO2)
+	if errors.Is(err, repository.ErrNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete data"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Swift code deleted"})
 }
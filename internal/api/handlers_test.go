@@ -0,0 +1,577 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/api"
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/Mekambee/Swift-Codes-Api/internal/repository"
+	"github.com/Mekambee/Swift-Codes-Api/internal/services"
+)
+
+// newTestRouter returns a router backed by an in-memory repository holding one HQ and one branch.
+func newTestRouter(t *testing.T) (*gin.Engine, *repository.MemoryRepository) {
+	repo := repository.NewMemoryRepository()
+	err := repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1XXX", BankName: "TEST BANK", Address: "HQ ADDRESS", CountryISO2: "PL", CountryName: "POLAND", IsHeadquarter: true},
+		{SwiftCode: "TESTPLW1ABC", BankName: "TEST BANK", Address: "BRANCH ADDRESS", CountryISO2: "PL", CountryName: "POLAND"},
+	})
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	return api.SetupRouter(services.NewSwiftService(repo)), repo
+}
+
+func doRequest(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// Tests that an HQ lookup includes its branches.
+func TestGetSwiftCodeHandler_HQ(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	w := doRequest(r, "GET", "/v1/swift-codes/TESTPLW1XXX", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, true, resp["isHeadquarter"])
+	branches, ok := resp["branches"].([]interface{})
+	assert.True(t, ok, "'branches' should be an array")
+	assert.Len(t, branches, 1)
+}
+
+// Tests that a code is found ignoring case and spaces, and a BIC8 resolves to its headquarter.
+func TestGetSwiftCodeHandler_Normalized(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	for path, form := range map[string]string{
+		"/v1/swift-codes/testplw1xxx":       models.MatchExact,
+		"/v1/swift-codes/%20TESTPLW1XXX%20": models.MatchExact,
+		"/v1/swift-codes/TESTPLW1":          models.MatchBIC8,
+	} {
+		w := doRequest(r, "GET", path, "")
+		require.Equal(t, http.StatusOK, w.Code, path)
+
+		var resp struct {
+			SwiftCode string           `json:"swiftCode"`
+			Branches  []interface{}    `json:"branches"`
+			Lookup    models.CodeMatch `json:"lookup"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "TESTPLW1XXX", resp.SwiftCode, path)
+		assert.Len(t, resp.Branches, 1, path)
+		assert.Equal(t, form, resp.Lookup.Form, path)
+		assert.Equal(t, "TESTPLW1XXX", resp.Lookup.Matched, path)
+	}
+
+	w := doRequest(r, "GET", "/v1/swift-codes/TESTPLW2", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	body := `{"address": "A", "bankName": "Test Bank", "countryISO2": "US", "swiftCode": " testusny123 "}`
+	w = doRequest(r, "POST", "/v1/swift-codes/", body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doRequest(r, "GET", "/v1/swift-codes/TESTUSNY123", "")
+	assert.Equal(t, http.StatusOK, w.Code, "The code should be stored normalized")
+
+	w = doRequest(r, "PATCH", "/v1/swift-codes/testusny123", `{"address": "B"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// Tests the batch lookup: found codes in the shape of a single lookup, unknown ones as sent.
+func TestLookupSwiftCodesHandler(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	body := `{"swiftCodes": ["testplw1", "NOPEPLW1XXX", "TESTPLW1ABC"], "includeBranches": true}`
+	w := doRequest(r, "POST", "/v1/swift-codes/lookup", body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Found    []map[string]interface{} `json:"found"`
+		NotFound []string                 `json:"notFound"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"NOPEPLW1XXX"}, resp.NotFound)
+	require.Len(t, resp.Found, 2)
+	assert.Equal(t, "TESTPLW1XXX", resp.Found[0]["swiftCode"])
+	assert.Len(t, resp.Found[0]["branches"], 1)
+	assert.Equal(t, "bic8", resp.Found[0]["lookup"].(map[string]interface{})["matchedForm"])
+	assert.Equal(t, "TESTPLW1ABC", resp.Found[1]["swiftCode"])
+
+	single := doRequest(r, "GET", "/v1/swift-codes/testplw1", "")
+	var want map[string]interface{}
+	require.NoError(t, json.Unmarshal(single.Body.Bytes(), &want))
+	assert.Equal(t, want, resp.Found[0], "A found code should look like a single lookup")
+
+	w = doRequest(r, "POST", "/v1/swift-codes/lookup", `{"swiftCodes": ["TESTPLW1XXX"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "branches")
+	assert.Contains(t, w.Body.String(), `"notFound":[]`)
+
+	w = doRequest(r, "POST", "/v1/swift-codes/lookup", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	codes := `"` + strings.Repeat(`A", "`, services.DefaultMaxLookupCodes) + `A"`
+	w = doRequest(r, "POST", "/v1/swift-codes/lookup", `{"swiftCodes": [`+codes+`]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "too many codes")
+}
+
+// Tests the search endpoint's query parameters and response.
+func TestSearchSwiftCodesHandler(t *testing.T) {
+	r, repo := newTestRouter(t)
+	require.NoError(t, repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "SPKADEFFXXX", BankName: "SPARKASSE KOELN", CountryISO2: "DE", IsHeadquarter: true},
+		{SwiftCode: "SPARATWWXXX", BankName: "ERSTE SPARKASSE", CountryISO2: "AT", IsHeadquarter: true},
+		{SwiftCode: "SPARATWW123", BankName: "ERSTE SPARKASSE", CountryISO2: "AT"},
+	}))
+
+	w := doRequest(r, "GET", "/v1/swift-codes?bankName=Sparkasse&countryISO2=de,at&isHeadquarter=true&sort=-swiftCode", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		SwiftCodes []models.SwiftCodeData `json:"swiftCodes"`
+		Total      int                    `json:"total"`
+		Limit      int                    `json:"limit"`
+		Offset     int                    `json:"offset"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Total)
+	assert.Equal(t, 50, resp.Limit)
+	require.Len(t, resp.SwiftCodes, 2)
+	assert.Equal(t, "SPKADEFFXXX", resp.SwiftCodes[0].SwiftCode)
+
+	w = doRequest(r, "GET", "/v1/swift-codes?countryISO2=AT&countryISO2=PL&limit=1&offset=1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 4, resp.Total)
+	assert.Len(t, resp.SwiftCodes, 1)
+
+	for _, query := range []string{"countryISO2=QQ", "isHeadquarter=maybe", "sort=version", "limit=501", "offset=-1"} {
+		w = doRequest(r, "GET", "/v1/swift-codes?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+// Tests the fuzzy search endpoint: scored results best first, and its parameter checks.
+func TestFuzzySearchHandler(t *testing.T) {
+	r, repo := newTestRouter(t)
+	require.NoError(t, repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "PKOPPLPWXXX", BankName: "BANK POLSKA KASA OPIEKI SA", CountryISO2: "PL", IsHeadquarter: true},
+	}))
+
+	w := doRequest(r, "GET", "/v1/swift-codes/search?q=Bank%20Polska%20Kasa%20Opieki&countryISO2=pl", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Query   string                   `json:"query"`
+		Results []models.ScoredSwiftCode `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotEmpty(t, resp.Results)
+	assert.Equal(t, "PKOPPLPWXXX", resp.Results[0].SwiftCode)
+	assert.Equal(t, 1.0, resp.Results[0].Score)
+	assert.Equal(t, "BANK POLSKA KASA OPIEKI SA", resp.Results[0].BankName)
+
+	w = doRequest(r, "GET", "/v1/swift-codes/search?q=zzzz", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"results":[]`)
+
+	for _, query := range []string{"", "q=bank&minScore=0", "q=bank&minScore=2", "q=bank&limit=101", "q=bank&countryISO2=QQ"} {
+		w = doRequest(r, "GET", "/v1/swift-codes/search?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+// Tests following the cursor through a country's pages, and listing only its headquarters.
+func TestGetByCountryHandler_Pages(t *testing.T) {
+	r, repo := newTestRouter(t)
+	require.NoError(t, repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "AAAAPLPWXXX", BankName: "A", CountryISO2: "PL", IsHeadquarter: true},
+		{SwiftCode: "AAAAPLPW123", BankName: "A", CountryISO2: "PL"},
+	}))
+
+	type page struct {
+		SwiftCodes []models.Headquarter `json:"swiftCodes"`
+		NextCursor string               `json:"nextCursor"`
+	}
+	var seen []string
+	path := "/v1/swift-codes/country/PL?limit=3"
+	for i := 0; path != ""; i++ {
+		require.Less(t, i, 3, "The cursor should come to an end")
+		w := doRequest(r, "GET", path, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp page
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		for _, sc := range resp.SwiftCodes {
+			seen = append(seen, sc.SwiftCode)
+		}
+		path = ""
+		if resp.NextCursor != "" {
+			path = "/v1/swift-codes/country/PL?limit=3&cursor=" + resp.NextCursor
+		}
+	}
+	assert.Equal(t, []string{"AAAAPLPW123", "AAAAPLPWXXX", "TESTPLW1ABC", "TESTPLW1XXX"}, seen)
+
+	w := doRequest(r, "GET", "/v1/swift-codes/country/PL?headquartersOnly=true", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp page
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.SwiftCodes, 2)
+	assert.Equal(t, 1, resp.SwiftCodes[1].BranchCount)
+	assert.Empty(t, resp.NextCursor)
+	assert.NotContains(t, w.Body.String(), "nextCursor")
+
+	for _, query := range []string{"cursor=!!", "limit=0", "limit=1001", "headquartersOnly=maybe"} {
+		w = doRequest(r, "GET", "/v1/swift-codes/country/PL?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+// Tests that a country is returned whole, without nextCursor, when neither
+// limit nor cursor is sent, also beyond the default page size of 100.
+func TestGetByCountryHandler_Unpaged(t *testing.T) {
+	const defaultCountryLimit = 100
+	r, repo := newTestRouter(t)
+	data := make([]models.SwiftCodeData, defaultCountryLimit+1)
+	for i := range data {
+		data[i] = models.SwiftCodeData{SwiftCode: fmt.Sprintf("AAAADEFF%03d", i), BankName: "A", CountryISO2: "DE"}
+	}
+	require.NoError(t, repo.SaveSwiftCodes(data))
+
+	var resp struct {
+		SwiftCodes []models.SwiftCodeData `json:"swiftCodes"`
+		NextCursor string                 `json:"nextCursor"`
+	}
+	w := doRequest(r, "GET", "/v1/swift-codes/country/DE", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.SwiftCodes, defaultCountryLimit+1)
+	assert.NotContains(t, w.Body.String(), "nextCursor")
+
+	w = doRequest(r, "GET", fmt.Sprintf("/v1/swift-codes/country/DE?limit=%d", defaultCountryLimit), "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.SwiftCodes, defaultCountryLimit)
+	assert.NotEmpty(t, resp.NextCursor)
+}
+
+// Tests the country tree endpoint: headquarters with nested branches and an orphans group, always arrays.
+func TestGetCountryTreeHandler(t *testing.T) {
+	r, repo := newTestRouter(t)
+	require.NoError(t, repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "ORPHPLPW123", BankName: "ORPHAN", CountryISO2: "PL"},
+	}))
+
+	w := doRequest(r, "GET", "/v1/swift-codes/country/pl/tree", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var tree models.CountryTree
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tree))
+	assert.Equal(t, "PL", tree.CountryISO2)
+	require.Len(t, tree.Headquarters, 1)
+	assert.Equal(t, "TESTPLW1XXX", tree.Headquarters[0].SwiftCode)
+	require.Len(t, tree.Headquarters[0].Branches, 1)
+	assert.Equal(t, "TESTPLW1ABC", tree.Headquarters[0].Branches[0].SwiftCode)
+	require.Len(t, tree.Orphans, 1)
+	assert.Equal(t, "ORPHPLPW123", tree.Orphans[0].SwiftCode)
+
+	require.NoError(t, repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "TESTDEFFXXX", BankName: "TEST BANK DE", CountryISO2: "DE", IsHeadquarter: true},
+	}))
+	w = doRequest(r, "GET", "/v1/swift-codes/country/DE/tree", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"branches":[]`)
+	assert.Contains(t, w.Body.String(), `"orphans":[]`)
+
+	w = doRequest(r, "GET", "/v1/swift-codes/country/US/tree", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// Tests that an unknown code answers 404.
+func TestGetSwiftCodeHandler_NotFound(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	w := doRequest(r, "GET", "/v1/swift-codes/NOPEPLW1XXX", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// Tests the country listing with a lower-case ISO2 in the path.
+func TestGetByCountryHandler(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	w := doRequest(r, "GET", "/v1/swift-codes/country/pl", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "PL", resp["countryISO2"])
+	assert.Equal(t, "POLAND", resp["countryName"])
+	assert.Len(t, resp["swiftCodes"], 2)
+
+	w = doRequest(r, "GET", "/v1/swift-codes/country/DE", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// Tests that POST stores the record with upper-cased country fields.
+func TestCreateSwiftCodeHandler(t *testing.T) {
+	r, repo := newTestRouter(t)
+
+	body := `{
+		"address": "Some address",
+		"bankName": "Test Bank",
+		"countryISO2": "us",
+		"countryName": "united states",
+		"isHeadquarter": true,
+		"swiftCode": "TESTUSNYXXX"
+	}`
+	w := doRequest(r, "POST", "/v1/swift-codes/", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	sc, err := repo.GetSwiftCode("TESTUSNYXXX")
+	assert.NoError(t, err)
+	assert.Equal(t, "US", sc.CountryISO2)
+	assert.Equal(t, "UNITED STATES", sc.CountryName)
+
+	w = doRequest(r, "POST", "/v1/swift-codes/", `{"swiftCode": "TESTUSNYXXX"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Missing fields should be rejected")
+}
+
+// Tests that POST rejects a SWIFT code with a broken structure or another country, listing the failed checks.
+func TestCreateSwiftCodeHandler_InvalidCode(t *testing.T) {
+	r, repo := newTestRouter(t)
+
+	body := `{"address": "A", "bankName": "Test Bank", "countryISO2": "DE", "countryName": "GERMANY",
+		"isHeadquarter": true, "swiftCode": "TE5TUSNYXXX"}`
+	w := doRequest(r, "POST", "/v1/swift-codes/", body)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var resp struct {
+		Failures []struct {
+			Check string `json:"check"`
+		} `json:"failures"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Failures, 2)
+	assert.Equal(t, "institution", resp.Failures[0].Check)
+	assert.Equal(t, "countryMatch", resp.Failures[1].Check)
+
+	_, err := repo.GetSwiftCode("TE5TUSNYXXX")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+// Tests that isHeadquarter is derived from the code when left out and rejected when it contradicts it.
+func TestHeadquarterFlag(t *testing.T) {
+	r, repo := newTestRouter(t)
+
+	body := `{"address": "A", "bankName": "Test Bank", "countryISO2": "US", "swiftCode": "TESTUSNYXXX"}`
+	w := doRequest(r, "POST", "/v1/swift-codes/", body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	sc, err := repo.GetSwiftCode("TESTUSNYXXX")
+	require.NoError(t, err)
+	assert.True(t, sc.IsHeadquarter)
+
+	body = `{"address": "A", "bankName": "Test Bank", "countryISO2": "US", "swiftCode": "TESTUSNY123", "isHeadquarter": true}`
+	w = doRequest(r, "POST", "/v1/swift-codes/", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "XXX")
+
+	body = `{"address": "A", "bankName": "Test Bank", "countryISO2": "PL", "isHeadquarter": false}`
+	w = doRequest(r, "PUT", "/v1/swift-codes/TESTPLW1XXX", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(r, "PATCH", "/v1/swift-codes/TESTPLW1ABC", `{"isHeadquarter": true}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	sc, err = repo.GetSwiftCode("TESTPLW1ABC")
+	require.NoError(t, err)
+	assert.False(t, sc.IsHeadquarter)
+}
+
+// Tests that the validate endpoint reports each failed check and stores nothing.
+func TestValidateSwiftCodeHandler(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	w := doRequest(r, "POST", "/v1/swift-codes/validate", `{"swiftCode": "BREXPLPWXXX", "countryISO2": "pl"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, true, resp["valid"])
+	assert.Empty(t, resp["failures"])
+
+	w = doRequest(r, "POST", "/v1/swift-codes/validate", `{"swiftCode": "BREXQQ-WXX"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, false, resp["valid"])
+	assert.Len(t, resp["failures"], 3, "length, country and location should fail")
+
+	w = doRequest(r, "POST", "/v1/swift-codes/validate", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// Tests that country names come from the ISO 3166 reference and unknown countries are rejected.
+func TestCanonicalCountryName(t *testing.T) {
+	r, repo := newTestRouter(t)
+
+	body := `{"address": "A", "bankName": "Deutsche Bank", "countryISO2": "de", "countryName": "Deutschland",
+		"isHeadquarter": true, "swiftCode": "DEUTDEFFXXX"}`
+	w := doRequest(r, "POST", "/v1/swift-codes/", body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	sc, err := repo.GetSwiftCode("DEUTDEFFXXX")
+	require.NoError(t, err)
+	assert.Equal(t, "GERMANY", sc.CountryName)
+
+	body = `{"address": "A", "bankName": "Nowhere Bank", "countryISO2": "QQ", "swiftCode": "NOWHQQFFXXX"}`
+	w = doRequest(r, "POST", "/v1/swift-codes/", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown countryISO2")
+
+	w = doRequest(r, "PATCH", "/v1/swift-codes/DEUTDEFFXXX", `{"countryName": "ALLEMAGNE"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"countryName":"GERMANY"`)
+}
+
+// Tests the country list with headquarter and branch counts.
+func TestListCountriesHandler(t *testing.T) {
+	r, repo := newTestRouter(t)
+	require.NoError(t, repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "DEUTDEFFXXX", BankName: "DEUTSCHE BANK", CountryISO2: "DE", CountryName: "DEUTSCHLAND", IsHeadquarter: true},
+	}))
+
+	w := doRequest(r, "GET", "/v1/countries", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Countries []models.CountrySummary `json:"countries"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []models.CountrySummary{
+		{CountryISO2: "DE", CountryName: "GERMANY", Headquarters: 1},
+		{CountryISO2: "PL", CountryName: "POLAND", Headquarters: 1, Branches: 1},
+	}, resp.Countries, "Names should come from the reference, not from the stored data")
+}
+
+// Tests that code type and time zone are stored, returned and usable as
+// country listing filters, and that an unknown time zone is rejected.
+func TestCodeTypeAndTimeZone(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	body := `{
+		"address": "UL. PROSTA 18",
+		"bankName": "MBANK S.A.",
+		"countryISO2": "PL",
+		"countryName": "POLAND",
+		"isHeadquarter": true,
+		"swiftCode": "BREXPLPWXXX",
+		"codeType": "bic11",
+		"timeZone": "Europe/Warsaw"
+	}`
+	w := doRequest(r, "POST", "/v1/swift-codes/", body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doRequest(r, "GET", "/v1/swift-codes/BREXPLPWXXX", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var sc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sc))
+	assert.Equal(t, "BIC11", sc["codeType"])
+	assert.Equal(t, "Europe/Warsaw", sc["timeZone"])
+
+	w = doRequest(r, "GET", "/v1/swift-codes/country/PL?timeZone=Europe/Warsaw&codeType=BIC11", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var country struct {
+		SwiftCodes []models.SwiftCodeData `json:"swiftCodes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &country))
+	require.Len(t, country.SwiftCodes, 1)
+	assert.Equal(t, "BREXPLPWXXX", country.SwiftCodes[0].SwiftCode)
+
+	w = doRequest(r, "GET", "/v1/swift-codes/country/PL?timeZone=Europe/Berlin", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(r, "PATCH", "/v1/swift-codes/BREXPLPWXXX", `{"timeZone": "Mars/Olympus"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(r, "POST", "/v1/swift-codes/", strings.Replace(body, "Europe/Warsaw", "Local", 1))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// Tests that the town is returned apart from the address and filters a country listing.
+func TestTownFilter(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	body := `{"address": "UL. PROSTA 18", "town": "Warszawa", "postalCode": "00-850", "bankName": "MBANK S.A.",
+		"countryISO2": "PL", "countryName": "POLAND", "isHeadquarter": true, "swiftCode": "BREXPLPWXXX"}`
+	w := doRequest(r, "POST", "/v1/swift-codes/", body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = doRequest(r, "GET", "/v1/swift-codes/BREXPLPWXXX", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var sc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sc))
+	assert.Equal(t, "UL. PROSTA 18", sc["address"])
+	assert.Equal(t, "WARSZAWA", sc["town"])
+	assert.Equal(t, "00-850", sc["postalCode"])
+
+	w = doRequest(r, "GET", "/v1/swift-codes/country/PL?town=warszawa", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var country struct {
+		SwiftCodes []models.SwiftCodeData `json:"swiftCodes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &country))
+	require.Len(t, country.SwiftCodes, 1)
+	assert.Equal(t, "BREXPLPWXXX", country.SwiftCodes[0].SwiftCode)
+}
+
+// Tests that DELETE only removes a record when bank name and country match.
+func TestDeleteSwiftCodeHandler(t *testing.T) {
+	r, repo := newTestRouter(t)
+
+	w := doRequest(r, "DELETE", "/v1/swift-codes/TESTPLW1ABC", `{"bankName":"OTHER BANK","countryISO2":"PL"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(r, "DELETE", "/v1/swift-codes/TESTPLW1ABC", `{"bankName":"TEST BANK","countryISO2":"pl"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	_, err := repo.GetSwiftCode("TESTPLW1ABC")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+// Tests that a read-only service refuses the writing endpoints with 503 and
+// still serves reads.
+func TestSetupRouter_ReadOnly(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	require.NoError(t, repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1XXX", BankName: "TEST BANK", Address: "HQ ADDRESS", CountryISO2: "PL", CountryName: "POLAND", IsHeadquarter: true},
+	}))
+	service := services.NewSwiftService(repo)
+	service.SetReadOnly(true)
+	gin.SetMode(gin.TestMode)
+	r := api.SetupRouter(service)
+
+	body := `{"swiftCode":"TESTPLW1ABC","bankName":"TEST BANK","address":"A","countryISO2":"PL","countryName":"POLAND","isHeadquarter":false}`
+	for _, req := range []struct{ method, path, body string }{
+		{"POST", "/v1/swift-codes/", body},
+		{"PUT", "/v1/swift-codes/TESTPLW1XXX", body},
+		{"PATCH", "/v1/swift-codes/TESTPLW1XXX", `{"address":"NEW"}`},
+		{"DELETE", "/v1/swift-codes/TESTPLW1XXX", ""},
+		{"POST", "/v1/swift-codes/import", ""},
+		{"POST", "/v1/swift-codes/bulk", "[" + body + "]"},
+		{"POST", "/v1/imports/abc/cancel", ""},
+	} {
+		w := doRequest(r, req.method, req.path, req.body)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, "%s %s", req.method, req.path)
+		assert.Contains(t, w.Body.String(), "read-only", "%s %s", req.method, req.path)
+	}
+
+	w := doRequest(r, "GET", "/v1/swift-codes/TESTPLW1XXX", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "HQ ADDRESS")
+	w = doRequest(r, "GET", "/v1/imports", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
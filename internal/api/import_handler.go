@@ -1,37 +1,370 @@
 package api
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
 	"github.com/Mekambee/Swift-Codes-Api/internal/services"
 	"github.com/gin-gonic/gin"
 )
 
-func ImportSwiftCodesHandler(c *gin.Context) {
-	file, err := c.FormFile("file")
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// POST /v1/swift-codes/import
+// multipart/form-data with an .xlsx, .csv or .tsv in "file", an optional "mode"
+// (insert, upsert, replace or sync; also accepted as a query parameter),
+// optional "columns", a JSON object mapping fields to header names, and for
+// CSV optional "delimiter" and "encoding" (detected when absent).
+// The file is imported by a background job; the response is 202 with the
+// job, to be followed at GET /v1/imports/{id}.
+func (h *Handler) ImportSwiftCodesHandler(c *gin.Context) {
+	up, ok := receiveUpload(c, h.service.MaxImportBytes())
+	if !ok {
+		return
+	}
+
+	job, err := h.service.StartImport(up.path, up.opts, models.ImportJob{
+		FileName: up.fileName,
+		Checksum: up.checksum,
+		Uploader: uploader(c),
+		Mode:     up.mode,
+	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file found"})
+		os.Remove(up.path)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start import"})
 		return
 	}
 
-	tempPath := filepath.Join("/tmp", file.Filename)
-	if err := c.SaveUploadedFile(file, tempPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot save file"})
+	c.Header("Location", "/v1/imports/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GET /v1/imports?limit=&offset=
+// The history of imports, newest first, without the rejected rows of each report.
+func (h *Handler) ListImportsHandler(c *gin.Context) {
+	limit, err := queryInt(c, "limit", defaultImportsLimit, 1, maxImportsLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset, err := queryInt(c, "offset", 0, 0, math.MaxInt32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	jobs, err := h.service.ListImports(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve imports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"imports": jobs,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+const (
+	defaultImportsLimit = 50
+	maxImportsLimit     = 500
+)
+
+// queryInt reads an optional integer query parameter within [lo, hi].
+func queryInt(c *gin.Context, name string, def, lo, hi int) (int, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return def, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < lo || value > hi {
+		return 0, fmt.Errorf("%s must be an integer between %d and %d", name, lo, hi)
+	}
+	return value, nil
+}
+
+// maxUploaderLength is the size of the imports.uploader column.
+const maxUploaderLength = 255
+
+// uploader identifies who sent an import for the import history: the
+// X-Uploader header when set, otherwise the client address.
+func uploader(c *gin.Context) string {
+	name := strings.TrimSpace(c.GetHeader("X-Uploader"))
+	if name == "" {
+		return c.ClientIP()
+	}
+	if len(name) > maxUploaderLength {
+		name = name[:maxUploaderLength]
+		for !utf8.ValidString(name) {
+			name = name[:len(name)-1]
+		}
+	}
+	return name
+}
+
+// GET /v1/imports/{id}
+// State and progress of an import job; once it succeeded also its result and report.
+func (h *Handler) GetImportHandler(c *gin.Context) {
+	job, err := h.service.GetImport(c.Param("id"))
+	if errors.Is(err, services.ErrImportNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve import"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// POST /v1/imports/{id}/cancel
+// Stops a running import job and rolls back everything it wrote.
+func (h *Handler) CancelImportHandler(c *gin.Context) {
+	job, err := h.service.CancelImport(c.Param("id"))
+	switch {
+	case errors.Is(err, services.ErrImportNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrImportFinished), errors.Is(err, services.ErrImportNotRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not cancel import"})
+	default:
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// POST /v1/swift-codes/bulk
+// Takes a JSON array or NDJSON (one object per line) of records shaped like
+// the POST /v1/swift-codes/ body, with an optional "mode" query parameter.
+// Records are validated, imported and reported like file rows, and the
+// import is recorded in the history like a file import.
+func (h *Handler) BulkImportHandler(c *gin.Context) {
+	mode, err := models.ParseImportMode(c.Query("mode"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, h.service.MaxImportBytes())
+	job, err := h.service.ImportJSON(body, mode, uploader(c))
+	if errors.Is(err, services.ErrStorage) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return
+	}
+	if message := tooLarge(err); message != "" {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": message, "importId": job.ID})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Malformed JSON body: %v", err), "importId": job.ID})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Import successful",
+		"importId": job.ID,
+		"mode":     mode,
+		"result":   job.Result,
+		"report":   job.Report,
+	})
+}
+
+// POST /v1/swift-codes/import/dry-run
+// Takes the same form as the import, validates the file and answers with the
+// codes it would add, change or remove. Nothing is written.
+func (h *Handler) DryRunImportHandler(c *gin.Context) {
+	up, ok := receiveUpload(c, h.service.MaxImportBytes())
+	if !ok {
+		return
+	}
+	defer os.Remove(up.path)
+
+	swiftData, report, err := h.service.ParseFile(up.path, up.opts)
+	if err != nil {
+		respondImportError(c, err)
 		return
 	}
+	report.FileName = up.fileName
+	h.service.StoreReport(report)
 
-	swiftData, err := services.ParseSwiftXLSX(tempPath)
+	diff, err := h.service.PreviewImport(swiftData, up.mode)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing XLSX"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
 		return
 	}
 
-	err = services.SaveSwiftCodes(swiftData)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Dry run, nothing was imported",
+		"mode":    up.mode,
+		"diff":    diff,
+		"report":  report,
+	})
+}
+
+// upload is an import file saved to disk with the options sent along.
+type upload struct {
+	path     string
+	fileName string
+	// checksum is the hex SHA-256 of the file.
+	checksum string
+	opts     services.ParseOptions
+	mode     models.ImportMode
+}
+
+// receiveUpload reads the form of an import, of at most maxBytes, and saves
+// the uploaded file. On failure it has already written the error response.
+func receiveUpload(c *gin.Context, maxBytes int64) (*upload, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	// Parsed up front, as the form getters below drop parsing errors.
+	if _, err := c.MultipartForm(); tooLarge(err) != "" {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": tooLarge(err)})
+		return nil, false
+	}
+
+	mode, err := models.ParseImportMode(c.DefaultPostForm("mode", c.Query("mode")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	columns, err := services.ParseColumnMapping(c.PostForm("columns"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file found"})
+		return nil, false
+	}
+
+	opts := services.ParseOptions{
+		Columns:  columns,
+		Format:   services.DetectFormat(file.Filename, file.Header.Get("Content-Type")),
+		Encoding: c.PostForm("encoding"),
+	}
+	if opts.Format == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported file type, expected .xlsx, .csv or .tsv"})
+		return nil, false
+	}
+	delimiter, ok := parseDelimiter(c.PostForm("delimiter"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "delimiter must be a single character or \"tab\""})
+		return nil, false
+	}
+	opts.Delimiter = delimiter
+
+	tempPath, checksum, err := saveTemp(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot save file"})
+		return nil, false
+	}
+
+	return &upload{path: tempPath, fileName: file.Filename, checksum: checksum, opts: opts, mode: mode}, true
+}
+
+// saveTemp saves an uploaded file under a unique temporary name with the
+// original extension, so concurrent uploads of the same file do not collide,
+// and returns its path and SHA-256.
+func saveTemp(file *multipart.FileHeader) (string, string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", "", err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp("", "swift-import-*"+filepath.Ext(file.Filename))
 	if err != nil {
+		return "", "", err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", "", err
+	}
+	return tmp.Name(), hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// tooLarge returns the message answered with 413 when err comes from reading
+// a body past its http.MaxBytesReader limit, and "" otherwise.
+func tooLarge(err error) string {
+	var maxBytes *http.MaxBytesError
+	if !errors.As(err, &maxBytes) {
+		return ""
+	}
+	return fmt.Sprintf("Request body larger than the limit of %d bytes", maxBytes.Limit)
+}
+
+// respondImportError maps a failed file import to a response: problems with
+// the file are the client's, storage failures the server's.
+func respondImportError(c *gin.Context, err error) {
+	var missing *services.MissingColumnsError
+	switch {
+	case errors.As(err, &missing):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "missingColumns": missing.Missing})
+	case errors.Is(err, services.ErrAmbiguousColumn), errors.Is(err, services.ErrUnsupportedEncoding):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrStorage):
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing file"})
+	}
+}
+
+// parseDelimiter reads the optional CSV delimiter; "" leaves it to detection.
+func parseDelimiter(value string) (rune, bool) {
+	switch value {
+	case "":
+		return 0, true
+	case "tab", `\t`:
+		return '\t', true
+	}
+	if utf8.RuneCountInString(value) != 1 {
+		return 0, false
+	}
+	r, _ := utf8.DecodeRuneInString(value)
+	return r, r != '"' && r != '\r' && r != '\n'
+}
+
+// GET /v1/imports/{id}/report
+// Downloads the rows rejected by an import as .xlsx, with an added ERROR column.
+func (h *Handler) DownloadImportReportHandler(c *gin.Context) {
+	report, err := h.service.GetReport(c.Param("id"))
+	if errors.Is(err, services.ErrReportNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve report"})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.WriteRejectedRowsXLSX(report, &buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not build report"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Import successful"})
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%s-rejected.xlsx"`, report.ID))
+	c.Data(http.StatusOK, xlsxContentType, buf.Bytes())
 }
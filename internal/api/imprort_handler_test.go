@@ -2,41 +2,49 @@ package api_test
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/Mekambee/Swift-Codes-Api/internal/api"
 	"github.com/Mekambee/Swift-Codes-Api/internal/database"
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/Mekambee/Swift-Codes-Api/internal/repository"
+	"github.com/Mekambee/Swift-Codes-Api/internal/services"
 )
 
-func TestImportSwiftCodesHandler(t *testing.T) {
-	err := database.ConnectAndMigrate("localhost", "myuser", "mysecretpassword", "swiftdb", "5432")
-	assert.NoError(t, err)
-	defer database.DB.Close()
-
-	database.DB.Exec("TRUNCATE swift_codes RESTART IDENTITY")
-
-	gin.SetMode(gin.TestMode)
-	r := gin.New()
-	r.POST("/v1/swift-codes/import", api.ImportSwiftCodesHandler)
+// newImportRequest builds a multipart upload of the given testdata file.
+func newImportRequest(t *testing.T, name string) *http.Request {
+	return newImportRequestWithFields(t, name, nil)
+}
 
+// newImportRequestWithFields is newImportRequest with extra form fields.
+func newImportRequestWithFields(t *testing.T, name string, fields map[string]string) *http.Request {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		assert.NoError(t, writer.WriteField(key, value))
+	}
 
-	testFile := filepath.Join("testdata", "import_endpoint_test.xlsx")
+	testFile := filepath.Join("testdata", name)
 	file, err := os.Open(testFile)
 	assert.NoError(t, err, "Should open file")
 	defer file.Close()
 
-	part, err := writer.CreateFormFile("file", "import_test.xlsx")
+	part, err := writer.CreateFormFile("file", "import_test"+filepath.Ext(name))
 	assert.NoError(t, err)
 
 	_, err = io.Copy(part, file)
@@ -46,15 +54,350 @@ func TestImportSwiftCodesHandler(t *testing.T) {
 
 	req, _ := http.NewRequest("POST", "/v1/swift-codes/import", body)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
 
+// runImport sends an import request, expects 202 and polls the job until it finishes.
+func runImport(t *testing.T, r http.Handler, req *http.Request) models.ImportJob {
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+	var job models.ImportJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	require.NotEmpty(t, job.ID)
+	assert.Equal(t, "/v1/imports/"+job.ID, w.Header().Get("Location"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !job.State.Finished() {
+		require.True(t, time.Now().Before(deadline), "import did not finish in time")
+		time.Sleep(10 * time.Millisecond)
+
+		w = httptest.NewRecorder()
+		poll, _ := http.NewRequest("GET", "/v1/imports/"+job.ID, nil)
+		r.ServeHTTP(w, poll)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	}
+	return job
+}
+
+func TestImportSwiftCodesHandler(t *testing.T) {
+	db, err := database.ConnectAndMigrate("localhost", "myuser", "mysecretpassword", "swiftdb", "5432")
+	require.NoError(t, err)
+	defer db.Close()
+
+	db.Exec("TRUNCATE swift_codes RESTART IDENTITY")
+
+	gin.SetMode(gin.TestMode)
+	r := api.SetupRouter(services.NewSwiftService(repository.NewPostgresRepository(db)))
 
-	assert.Equal(t, http.StatusOK, w.Code, "Expected 200 OK for import")
+	job := runImport(t, r, newImportRequest(t, "import_endpoint_test.xlsx"))
+	assert.Equal(t, models.ImportSucceeded, job.State, job.Error)
 
 	var count int
-	row := database.DB.QueryRow("SELECT COUNT(*) FROM swift_codes")
+	row := db.QueryRow("SELECT COUNT(*) FROM swift_codes")
 	err = row.Scan(&count)
 	assert.NoError(t, err)
 	assert.True(t, count > 0, "Should import at least one record")
 }
+
+// Tests the import flow against the in-memory repository, no database needed.
+func TestImportSwiftCodesHandler_Memory(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+
+	gin.SetMode(gin.TestMode)
+	r := api.SetupRouter(services.NewSwiftService(repo))
+
+	job := runImport(t, r, newImportRequest(t, "import_endpoint_test.xlsx"))
+	assert.Equal(t, models.ImportSucceeded, job.State, job.Error)
+
+	sc, err := repo.GetSwiftCode("AIPOPLP1XXX")
+	assert.NoError(t, err, "Imported code should be stored")
+	assert.Equal(t, "PL", sc.CountryISO2)
+}
+
+// Tests that re-importing the same file in upsert mode reports every row as unchanged.
+func TestImportSwiftCodesHandler_Modes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := api.SetupRouter(services.NewSwiftService(repository.NewMemoryRepository()))
+
+	first := runImport(t, r, newImportRequest(t, "import_endpoint_test.xlsx"))
+	require.NotNil(t, first.Result)
+	assert.True(t, first.Result.Inserted > 0)
+
+	req := newImportRequest(t, "import_endpoint_test.xlsx")
+	req.URL.RawQuery = "mode=upsert"
+	second := runImport(t, r, req)
+	assert.Equal(t, models.ImportUpsert, second.Mode)
+	require.NotNil(t, second.Result)
+	assert.Equal(t, models.ImportResult{Unchanged: first.Result.Inserted}, *second.Result)
+
+	req = newImportRequest(t, "import_endpoint_test.xlsx")
+	req.URL.RawQuery = "mode=merge"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Unknown modes should be rejected")
+}
+
+// Tests that the finished job carries the row report and that rejected rows can be downloaded.
+func TestImportSwiftCodesHandler_Report(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := api.SetupRouter(services.NewSwiftService(repository.NewMemoryRepository()))
+
+	job := runImport(t, r, newImportRequest(t, "import_invalid_rows.xlsx"))
+	require.NotNil(t, job.Result)
+	require.NotNil(t, job.Report)
+	assert.Equal(t, 2, job.Result.Inserted)
+	assert.Equal(t, 6, job.Report.TotalRows)
+	assert.Equal(t, 4, job.Report.Rejected)
+	assert.Equal(t, job.ID, job.Report.ID)
+	assert.Equal(t, models.ImportProgress{RowsAccepted: 2, RowsWritten: 2}, job.Progress)
+
+	req, _ := http.NewRequest("GET", "/v1/imports/"+job.Report.ID+"/report", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".xlsx")
+	assert.True(t, w.Body.Len() > 0)
+
+	req, _ = http.NewRequest("GET", "/v1/imports/unknown/report", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// Tests that a dry run reports the diff and leaves the repository untouched.
+func TestDryRunImportHandler(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	err := repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "AIPOPLP1XXX", BankName: "OLD NAME", Address: "STRZEGOMSKA 42C  WROCLAW, DOLNOSLASKIE, 53-611, WROCLAW", CountryISO2: "PL", CountryName: "POLAND", IsHeadquarter: true},
+		{SwiftCode: "TESTDEFFXXX", BankName: "GONE BANK", CountryISO2: "DE", CountryName: "GERMANY", IsHeadquarter: true},
+	})
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := api.SetupRouter(services.NewSwiftService(repo))
+
+	req := newImportRequest(t, "import_endpoint_test.xlsx")
+	req.URL.Path = "/v1/swift-codes/import/dry-run"
+	req.URL.RawQuery = "mode=sync"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Diff models.ImportDiff `json:"diff"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"TESTDEFFXXX"}, resp.Diff.Removed)
+	assert.Len(t, resp.Diff.Changed, 1)
+	assert.Equal(t, "bankName", resp.Diff.Changed[0].Fields[0].Field)
+	assert.Equal(t, 11, resp.Diff.Summary.Inserted)
+
+	codes, _ := repo.ListCodes()
+	assert.Len(t, codes, 2, "A dry run must not write")
+}
+
+// Tests that missing columns fail the job naming them, and that a "columns"
+// mapping sent with the upload lets the same file be imported.
+func TestImportSwiftCodesHandler_Columns(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	job := runImport(t, r, newImportRequest(t, "import_custom_headers.xlsx"))
+	assert.Equal(t, models.ImportFailed, job.State)
+	assert.Contains(t, job.Error, "SWIFT CODE (swiftCode)")
+
+	req := newImportRequest(t, "import_custom_headers.xlsx")
+	req.URL.Path = "/v1/swift-codes/import/dry-run"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "A dry run should answer 400 for missing columns")
+	assert.Contains(t, w.Body.String(), "SWIFT CODE (swiftCode)")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, newImportRequestWithFields(t, "import_custom_headers.xlsx", map[string]string{"columns": "not json"}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	columns := `{"swiftCode": "INSTITUTION BIC", "bankName": "LEGAL NAME"}`
+	job = runImport(t, r, newImportRequestWithFields(t, "import_custom_headers.xlsx", map[string]string{"columns": columns}))
+	require.Equal(t, models.ImportSucceeded, job.State, job.Error)
+
+	w = doRequest(r, "GET", "/v1/swift-codes/BREXPLPWXXX", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "MBANK S.A.")
+}
+
+// Tests that a Windows-1250 CSV upload is detected by extension and decoded.
+func TestImportSwiftCodesHandler_CSV(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	job := runImport(t, r, newImportRequest(t, "import_cp1250.csv"))
+	require.Equal(t, models.ImportSucceeded, job.State, job.Error)
+
+	w := doRequest(r, "GET", "/v1/swift-codes/BREXPLPWLOD", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "ŻÓŁKIEWSKIEGO")
+
+	job = runImport(t, r, newImportRequestWithFields(t, "import_cp1250.csv", map[string]string{"encoding": "ebcdic"}))
+	assert.Equal(t, models.ImportFailed, job.State)
+	assert.Contains(t, job.Error, "unsupported encoding")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, newImportRequestWithFields(t, "import_cp1250.csv", map[string]string{"delimiter": ";;"}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// Tests the JSON and NDJSON bulk import endpoint.
+func TestBulkImportHandler(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	body := `[{"swiftCode": "BREXPLPWXXX", "bankName": "MBANK S.A.", "address": "UL. PROSTA 18", "countryISO2": "PL", "countryName": "POLAND", "isHeadquarter": true}]`
+	w := doRequest(r, "POST", "/v1/swift-codes/bulk", body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Result models.ImportResult `json:"result"`
+		Report models.ImportReport `json:"report"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Result.Inserted)
+
+	ndjson := `{"swiftCode": "BREXPLPWXXX", "bankName": "MBANK SPOLKA AKCYJNA", "address": "UL. PROSTA 18", "countryISO2": "PL", "countryName": "POLAND"}` + "\n" +
+		`not json` + "\n" +
+		`{"swiftCode": "BREXPLPWLOD", "bankName": "MBANK S.A.", "address": "PIOTRKOWSKA 3", "countryISO2": "PL", "countryName": "POLAND"}` + "\n"
+	w = doRequest(r, "POST", "/v1/swift-codes/bulk?mode=upsert", ndjson)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Result.Inserted)
+	assert.Equal(t, 1, resp.Result.Updated)
+	assert.Equal(t, 1, resp.Report.Rejected)
+	assert.Equal(t, 2, resp.Report.Rejections[0].Row)
+
+	w = doRequest(r, "GET", "/v1/imports/"+resp.Report.ID+"/report", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(r, "POST", "/v1/swift-codes/bulk", `[{"swiftCode": `)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(r, "POST", "/v1/swift-codes/bulk?mode=merge", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// Tests the job endpoints for unknown and finished imports.
+func TestImportJobEndpoints(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	w := doRequest(r, "GET", "/v1/imports/unknown", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(r, "POST", "/v1/imports/unknown/cancel", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	job := runImport(t, r, newImportRequest(t, "import_endpoint_test.xlsx"))
+	require.Equal(t, models.ImportSucceeded, job.State, job.Error)
+	assert.NotNil(t, job.StartedAt)
+	assert.NotNil(t, job.FinishedAt)
+
+	w = doRequest(r, "POST", "/v1/imports/"+job.ID+"/cancel", "")
+	assert.Equal(t, http.StatusConflict, w.Code, "A finished import cannot be cancelled")
+}
+
+// Tests that file and bulk imports are listed in the history with their
+// checksum and uploader, and that imported codes point back to them.
+func TestImportHistory(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	req := newImportRequest(t, "import_endpoint_test.xlsx")
+	req.Header.Set("X-Uploader", "auditor@example.com")
+	job := runImport(t, r, req)
+	require.Equal(t, models.ImportSucceeded, job.State, job.Error)
+
+	content, err := os.ReadFile(filepath.Join("testdata", "import_endpoint_test.xlsx"))
+	require.NoError(t, err)
+	sum := sha256.Sum256(content)
+	assert.Equal(t, hex.EncodeToString(sum[:]), job.Checksum)
+	assert.Equal(t, "auditor@example.com", job.Uploader)
+
+	body := `{"swiftCode": "BREXPLPWLOD", "bankName": "MBANK S.A.", "address": "PIOTRKOWSKA 3", "countryISO2": "PL", "countryName": "POLAND"}` + "\n"
+	req, _ = http.NewRequest("POST", "/v1/swift-codes/bulk", strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.7:51000"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var bulk struct {
+		ImportID string `json:"importId"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bulk))
+
+	w = doRequest(r, "GET", "/v1/imports", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var history struct {
+		Imports []models.ImportJob `json:"imports"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	require.Len(t, history.Imports, 2)
+	assert.Equal(t, job.ID, history.Imports[1].ID)
+	assert.Equal(t, bulk.ImportID, history.Imports[0].ID)
+	assert.Equal(t, models.ImportSucceeded, history.Imports[0].State)
+	bodySum := sha256.Sum256([]byte(body))
+	assert.Equal(t, hex.EncodeToString(bodySum[:]), history.Imports[0].Checksum)
+	assert.Equal(t, "192.0.2.7", history.Imports[0].Uploader, "Without X-Uploader the client address is recorded")
+	assert.Empty(t, history.Imports[1].Report.Rejections, "The list leaves out rejected rows")
+
+	w = doRequest(r, "GET", "/v1/swift-codes/BREXPLPWLOD", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var sc struct {
+		ImportID  string `json:"importId"`
+		SourceRow int    `json:"sourceRow"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sc))
+	assert.Equal(t, bulk.ImportID, sc.ImportID)
+	assert.Equal(t, 1, sc.SourceRow)
+
+	w = doRequest(r, "GET", "/v1/imports?limit=1&offset=1", "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	require.Len(t, history.Imports, 1)
+	assert.Equal(t, job.ID, history.Imports[0].ID)
+
+	w = doRequest(r, "GET", "/v1/imports?limit=0", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// Tests that uploads and bulk bodies over the configured size answer 413.
+func TestImportHandlers_BodyLimit(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	service := services.NewSwiftService(repo)
+	require.NoError(t, service.SetMaxImportBytes(4096))
+	gin.SetMode(gin.TestMode)
+	r := api.SetupRouter(service)
+
+	for _, path := range []string{"/v1/swift-codes/import", "/v1/swift-codes/import/dry-run"} {
+		req := newImportRequest(t, "import_endpoint_test.xlsx")
+		req.URL.Path = path
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, path)
+		assert.Contains(t, w.Body.String(), "4096 bytes", path)
+	}
+
+	record := `{"swiftCode": "BREXPLPWXXX", "bankName": "MBANK S.A.", "address": "UL. PROSTA 18", "countryISO2": "PL", "countryName": "POLAND", "isHeadquarter": true}`
+	for name, body := range map[string]string{
+		"array":  "[" + strings.Repeat(record+",", 40) + record + "]",
+		"ndjson": strings.Repeat(record+"\n", 40),
+	} {
+		w := doRequest(r, "POST", "/v1/swift-codes/bulk", body)
+		require.Equal(t, http.StatusRequestEntityTooLarge, w.Code, name)
+		var resp struct {
+			ImportID string `json:"importId"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		job, err := repo.GetImport(resp.ImportID)
+		require.NoError(t, err, name)
+		assert.Equal(t, models.ImportFailed, job.State, name)
+	}
+	codes, _ := repo.ListCodes()
+	assert.Empty(t, codes, "Nothing of a body over the limit should be stored")
+
+	w := doRequest(r, "POST", "/v1/swift-codes/bulk", "["+record+"]")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
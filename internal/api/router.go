@@ -1,21 +1,45 @@
 package api
 
 import (
+	"github.com/Mekambee/Swift-Codes-Api/internal/services"
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter() *gin.Engine {
+// SetupRouter registers the endpoints. When the service is read-only, those
+// writing to the database answer 503 instead.
+func SetupRouter(service *services.SwiftService) *gin.Engine {
 	router := gin.Default()
+	h := NewHandler(service)
+	write := h.writeHandler
 
 	v1 := router.Group("/v1")
 	{
 		swiftCodes := v1.Group("/swift-codes")
 		{
-			swiftCodes.GET("/:swiftCode", GetSwiftCodeHandler)
-			swiftCodes.GET("/country/:countryISO2", GetByCountryHandler)
-			swiftCodes.POST("/", CreateSwiftCodeHandler)
-			swiftCodes.DELETE("/:swiftCode", DeleteSwiftCodeHandler)
-			swiftCodes.POST("/import", ImportSwiftCodesHandler)
+			swiftCodes.GET("", h.SearchSwiftCodesHandler)
+			swiftCodes.GET("/search", h.FuzzySearchHandler)
+			swiftCodes.GET("/:swiftCode", h.GetSwiftCodeHandler)
+			swiftCodes.GET("/country/:countryISO2", h.GetByCountryHandler)
+			swiftCodes.GET("/country/:countryISO2/tree", h.GetCountryTreeHandler)
+			swiftCodes.POST("/", write(h.CreateSwiftCodeHandler))
+			swiftCodes.POST("/validate", h.ValidateSwiftCodeHandler)
+			swiftCodes.POST("/lookup", h.LookupSwiftCodesHandler)
+			swiftCodes.PUT("/:swiftCode", write(h.UpdateSwiftCodeHandler))
+			swiftCodes.PATCH("/:swiftCode", write(h.PatchSwiftCodeHandler))
+			swiftCodes.DELETE("/:swiftCode", write(h.DeleteSwiftCodeHandler))
+			swiftCodes.POST("/import", write(h.ImportSwiftCodesHandler))
+			swiftCodes.POST("/import/dry-run", h.DryRunImportHandler)
+			swiftCodes.POST("/bulk", write(h.BulkImportHandler))
+		}
+
+		v1.GET("/countries", h.ListCountriesHandler)
+
+		imports := v1.Group("/imports")
+		{
+			imports.GET("", h.ListImportsHandler)
+			imports.GET("/:id", h.GetImportHandler)
+			imports.POST("/:id/cancel", write(h.CancelImportHandler))
+			imports.GET("/:id/report", h.DownloadImportReportHandler)
 		}
 	}
 
@@ -3,13 +3,15 @@ package api
 import (
 	"testing"
 
+	"github.com/Mekambee/Swift-Codes-Api/internal/repository"
+	"github.com/Mekambee/Swift-Codes-Api/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestSetupRouter(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	r := SetupRouter()
+	r := SetupRouter(services.NewSwiftService(repository.NewMemoryRepository()))
 	assert.NotNil(t, r, "SetupRouter should return a router")
 
 	routesInfo := r.Routes()
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/countries"
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/Mekambee/Swift-Codes-Api/internal/repository"
+	"github.com/Mekambee/Swift-Codes-Api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Endpoint 6: PUT /v1/swift-codes/{swiftCode}
+/*
+{
+"address": string,
+"bankName": string,
+"countryISO2": string,
+"countryName": string,
+"isHeadquarter": bool,
+"codeType": string,
+"timeZone": string,
+"town": string,
+"postalCode": string
+}
+*/
+type UpdateSwiftCodeRequest struct {
+	Address     string `json:"address" binding:"required"`
+	BankName    string `json:"bankName" binding:"required"`
+	CountryISO2 string `json:"countryISO2" binding:"required"`
+	// CountryName is optional and replaced by the ISO 3166 name of CountryISO2.
+	CountryName string `json:"countryName"`
+	// IsHeadquarter is optional, derived from the code; when sent it must agree.
+	IsHeadquarter *bool `json:"isHeadquarter"`
+	// SwiftCode is optional; when sent it must match the path.
+	SwiftCode string `json:"swiftCode"`
+	// CodeType, TimeZone, Town and PostalCode are optional; PUT clears them
+	// when left out.
+	CodeType   string `json:"codeType"`
+	TimeZone   string `json:"timeZone"`
+	Town       string `json:"town"`
+	PostalCode string `json:"postalCode"`
+}
+
+func (h *Handler) UpdateSwiftCodeHandler(c *gin.Context) {
+	swiftCode := models.NormalizeSwiftCode(c.Param("swiftCode"))
+
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "If-Match does not match the current version"})
+		return
+	}
+
+	var req UpdateSwiftCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.SwiftCode != "" && models.NormalizeSwiftCode(req.SwiftCode) != swiftCode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "swiftCode in body does not match the path"})
+		return
+	}
+	if _, ok := countries.Lookup(req.CountryISO2); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errUnknownCountry(req.CountryISO2)})
+		return
+	}
+	if !models.ValidTimeZone(req.TimeZone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errUnknownTimeZone(req.TimeZone)})
+		return
+	}
+	isHQ, err := services.HeadquarterFlag(swiftCode, req.IsHeadquarter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sc := models.SwiftCodeData{
+		SwiftCode:     swiftCode,
+		BankName:      req.BankName,
+		Address:       req.Address,
+		CountryISO2:   strings.ToUpper(req.CountryISO2),
+		CountryName:   strings.ToUpper(req.CountryName),
+		IsHeadquarter: isHQ,
+		CodeType:      models.NormalizeCodeType(req.CodeType),
+		TimeZone:      req.TimeZone,
+		Town:          models.NormalizeTown(req.Town),
+		PostalCode:    models.NormalizePostalCode(req.PostalCode),
+	}
+
+	updated, err := h.service.UpdateSwiftCode(sc, version)
+	h.respondUpdated(c, updated, err)
+}
+
+// Endpoint 7: PATCH /v1/swift-codes/{swiftCode}
+// Same body as PUT, but every field is optional.
+func (h *Handler) PatchSwiftCodeHandler(c *gin.Context) {
+	swiftCode := c.Param("swiftCode")
+
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "If-Match does not match the current version"})
+		return
+	}
+
+	var patch models.SwiftCodePatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if patch.IsEmpty() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+	if patch.CountryISO2 != nil {
+		iso2 := strings.ToUpper(*patch.CountryISO2)
+		if _, ok := countries.Lookup(iso2); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errUnknownCountry(iso2)})
+			return
+		}
+		patch.CountryISO2 = &iso2
+	}
+	if patch.CountryName != nil {
+		name := strings.ToUpper(*patch.CountryName)
+		patch.CountryName = &name
+	}
+	if patch.Town != nil {
+		town := models.NormalizeTown(*patch.Town)
+		patch.Town = &town
+	}
+	if patch.PostalCode != nil {
+		code := models.NormalizePostalCode(*patch.PostalCode)
+		patch.PostalCode = &code
+	}
+	if patch.CodeType != nil {
+		codeType := models.NormalizeCodeType(*patch.CodeType)
+		patch.CodeType = &codeType
+	}
+	if patch.TimeZone != nil && !models.ValidTimeZone(*patch.TimeZone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errUnknownTimeZone(*patch.TimeZone)})
+		return
+	}
+
+	updated, err := h.service.PatchSwiftCode(swiftCode, patch, version)
+	h.respondUpdated(c, updated, err)
+}
+
+func (h *Handler) respondUpdated(c *gin.Context, updated *models.SwiftCodeData, err error) {
+	var invalid *services.InvalidCodeError
+	switch {
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid SWIFT code", "failures": invalid.Failures})
+	case errors.Is(err, services.ErrHeadquarterMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Swift code not found"})
+	case errors.Is(err, repository.ErrVersionConflict):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update data"})
+	default:
+		c.Header("ETag", etag(updated.Version))
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func etag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatchVersion reads the If-Match header. A missing header or "*" gives
+// version 0, which means any version may be overwritten. ok is false when the
+// header holds a tag that can never match one of our ETags.
+func ifMatchVersion(c *gin.Context) (version int64, ok bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,133 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func doRequestIfMatch(r http.Handler, method, path, body, ifMatch string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// Tests a PUT guarded by the ETag returned from GET, and that replaying it with the old ETag fails.
+func TestUpdateSwiftCodeHandler_IfMatch(t *testing.T) {
+	r, repo := newTestRouter(t)
+
+	w := doRequest(r, "GET", "/v1/swift-codes/TESTPLW1ABC", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	tag := w.Header().Get("ETag")
+	assert.Equal(t, `"1"`, tag)
+
+	body := `{"address":"FIXED ADDRESS","bankName":"TEST BANK","countryISO2":"pl","countryName":"poland","isHeadquarter":false}`
+	w = doRequestIfMatch(r, "PUT", "/v1/swift-codes/TESTPLW1ABC", body, tag)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	var resp map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "FIXED ADDRESS", resp["address"])
+	assert.Equal(t, "PL", resp["countryISO2"])
+
+	w = doRequestIfMatch(r, "PUT", "/v1/swift-codes/TESTPLW1ABC", body, tag)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code, "A stale ETag should be rejected")
+
+	sc, _ := repo.GetSwiftCode("TESTPLW1ABC")
+	assert.Equal(t, int64(2), sc.Version)
+}
+
+// Tests PUT validation: missing fields, mismatching code and unknown code.
+func TestUpdateSwiftCodeHandler_Errors(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	w := doRequest(r, "PUT", "/v1/swift-codes/TESTPLW1ABC", `{"bankName":"ONLY NAME"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	body := `{"address":"A","bankName":"B","countryISO2":"PL","countryName":"POLAND","swiftCode":"TESTPLW1XYZ"}`
+	w = doRequest(r, "PUT", "/v1/swift-codes/TESTPLW1ABC", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(r, "PUT", "/v1/swift-codes/NOPEPLW1ABC", `{"address":"A","bankName":"B","countryISO2":"PL","countryName":"POLAND"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequestIfMatch(r, "PUT", "/v1/swift-codes/TESTPLW1ABC", `{"address":"A","bankName":"B","countryISO2":"PL","countryName":"POLAND"}`, `"abc"`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code, "A malformed ETag can never match")
+}
+
+// failedChecks decodes the failures listed in a 400 response.
+func failedChecks(t *testing.T, w *httptest.ResponseRecorder) []string {
+	var resp struct {
+		Failures []struct {
+			Check string `json:"check"`
+		} `json:"failures"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	var checks []string
+	for _, f := range resp.Failures {
+		checks = append(checks, f.Check)
+	}
+	return checks
+}
+
+// Tests that PUT cannot move a code to a country other than the one in its characters 5-6.
+func TestUpdateSwiftCodeHandler_CountryMismatch(t *testing.T) {
+	r, repo := newTestRouter(t)
+
+	body := `{"address":"A","bankName":"TEST BANK","countryISO2":"de","countryName":"GERMANY"}`
+	w := doRequest(r, "PUT", "/v1/swift-codes/TESTPLW1ABC", body)
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	assert.Equal(t, []string{"countryMatch"}, failedChecks(t, w))
+
+	sc, err := repo.GetSwiftCode("TESTPLW1ABC")
+	require.NoError(t, err)
+	assert.Equal(t, "PL", sc.CountryISO2)
+	assert.Equal(t, int64(1), sc.Version)
+}
+
+// Tests that PATCH validates the patched record, so it cannot change the country alone either.
+func TestPatchSwiftCodeHandler_CountryMismatch(t *testing.T) {
+	r, repo := newTestRouter(t)
+
+	w := doRequest(r, "PATCH", "/v1/swift-codes/TESTPLW1ABC", `{"countryISO2":"US"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	assert.Equal(t, []string{"countryMatch"}, failedChecks(t, w))
+
+	sc, err := repo.GetSwiftCode("TESTPLW1ABC")
+	require.NoError(t, err)
+	assert.Equal(t, "PL", sc.CountryISO2)
+
+	w = doRequest(r, "PATCH", "/v1/swift-codes/TESTPLW1ABC", `{"countryISO2":"pl","address":"NEW"}`)
+	assert.Equal(t, http.StatusOK, w.Code, "The code's own country is accepted in any case")
+}
+
+// Tests that PATCH changes only the given fields.
+func TestPatchSwiftCodeHandler(t *testing.T) {
+	r, repo := newTestRouter(t)
+
+	w := doRequestIfMatch(r, "PATCH", "/v1/swift-codes/TESTPLW1ABC", `{"address":"NEW ADDRESS"}`, `"1"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	sc, err := repo.GetSwiftCode("TESTPLW1ABC")
+	assert.NoError(t, err)
+	assert.Equal(t, "NEW ADDRESS", sc.Address)
+	assert.Equal(t, "TEST BANK", sc.BankName, "Fields not in the patch should be kept")
+
+	w = doRequestIfMatch(r, "PATCH", "/v1/swift-codes/TESTPLW1ABC", `{"bankName":"LATE EDIT"}`, `"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = doRequest(r, "PATCH", "/v1/swift-codes/TESTPLW1ABC", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "An empty patch should be rejected")
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Config holds the settings read from the environment at startup.
+type Config struct {
+	// DBDriver selects the storage backend: "postgres" (default) or "sqlite".
+	DBDriver string
+
+	DBHost     string
+	DBUser     string
+	DBPassword string
+	DBName     string
+	DBPort     string
+
+	// SQLitePath is the database file used by the sqlite driver.
+	SQLitePath string
+	// SQLiteReadOnly opens the file read-only, e.g. on edge nodes serving a prepared file.
+	SQLiteReadOnly bool
+
+	// MigrateOnStart applies pending schema migrations when the server starts.
+	// When disabled, run the "migrate" subcommand instead.
+	MigrateOnStart bool
+
+	// ImportColumnAliases is a JSON object of extra header names per field,
+	// e.g. {"swiftCode": ["BIC11"]}, used to read files from other providers.
+	ImportColumnAliases string
+
+	// LookupMaxCodes is the most codes accepted by one batch lookup.
+	LookupMaxCodes int
+
+	// ImportMaxBodyMB is the largest file upload or bulk body, in MiB,
+	// accepted by one import request.
+	ImportMaxBodyMB int
+
+	// InstanceID names this server among the instances sharing the database;
+	// it defaults to the host name. Import jobs record the instance running them.
+	InstanceID string
+}
+
+func Load() Config {
+	return Config{
+		DBDriver:       getEnv("DB_DRIVER", DriverPostgres),
+		DBHost:         getEnv("DB_HOST", "localhost"),
+		DBUser:         os.Getenv("DB_USER"),
+		DBPassword:     os.Getenv("DB_PASSWORD"),
+		DBName:         os.Getenv("DB_NAME"),
+		DBPort:         getEnv("DB_PORT", "5432"),
+		SQLitePath:     getEnv("SQLITE_PATH", "swift_codes.db"),
+		SQLiteReadOnly: getEnvBool("SQLITE_READ_ONLY", false),
+		MigrateOnStart: getEnvBool("MIGRATE_ON_START", true),
+
+		ImportColumnAliases: os.Getenv("IMPORT_COLUMN_ALIASES"),
+		LookupMaxCodes:      getEnvInt("LOOKUP_MAX_CODES", 1000),
+		ImportMaxBodyMB:     getEnvInt("IMPORT_MAX_BODY_MB", 64),
+		InstanceID:          getEnv("INSTANCE_ID", hostname()),
+	}
+}
+
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
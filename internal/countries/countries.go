@@ -0,0 +1,99 @@
+// Package countries holds the ISO 3166-1 reference data used to check country
+// codes and give every country one canonical name.
+package countries
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Country is one entry of the ISO 3166-1 reference table.
+type Country struct {
+	ISO2 string `json:"countryISO2"`
+	Name string `json:"countryName"`
+}
+
+//go:embed iso3166.csv
+var iso3166 string
+
+var all, byISO2 = mustLoad(iso3166)
+
+// Lookup returns the country with the ISO 3166-1 alpha-2 code iso2, matched
+// ignoring case and surrounding spaces.
+func Lookup(iso2 string) (Country, bool) {
+	country, ok := byISO2[strings.ToUpper(strings.TrimSpace(iso2))]
+	return country, ok
+}
+
+// Name returns the canonical name of iso2, or fallback for a code missing
+// from the reference table.
+func Name(iso2, fallback string) string {
+	if country, ok := Lookup(iso2); ok {
+		return country.Name
+	}
+	return fallback
+}
+
+// All returns every country of the reference table, ordered by code.
+func All() []Country {
+	return append([]Country(nil), all...)
+}
+
+// mustLoad reads the reference table; being embedded, a malformed one is a
+// build mistake rather than a runtime error.
+func mustLoad(data string) ([]Country, map[string]Country) {
+	list, err := load(strings.NewReader(data))
+	if err != nil {
+		panic(fmt.Sprintf("countries: %v", err))
+	}
+	index := make(map[string]Country, len(list))
+	for _, country := range list {
+		index[country.ISO2] = country
+	}
+	return list, index
+}
+
+// load parses "countryISO2,countryName" lines after a header line, skipping
+// # comments, and checks the codes are two upper-case letters and unique.
+func load(r io.Reader) ([]Country, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+
+	if _, err := reader.Read(); err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	var list []Country
+	seen := make(map[string]bool)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		country := Country{ISO2: record[0], Name: record[1]}
+		if !isCode(country.ISO2) || country.Name == "" {
+			return nil, fmt.Errorf("invalid entry %q", record)
+		}
+		if seen[country.ISO2] {
+			return nil, fmt.Errorf("duplicate code %q", country.ISO2)
+		}
+		seen[country.ISO2] = true
+		list = append(list, country)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].ISO2 < list[j].ISO2 })
+	return list, nil
+}
+
+func isCode(s string) bool {
+	return len(s) == 2 && s[0] >= 'A' && s[0] <= 'Z' && s[1] >= 'A' && s[1] <= 'Z'
+}
@@ -0,0 +1,49 @@
+package countries
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests lookups ignoring case and the fallback name of unknown codes.
+func TestLookup(t *testing.T) {
+	country, ok := Lookup(" pl ")
+	require.True(t, ok)
+	assert.Equal(t, Country{ISO2: "PL", Name: "POLAND"}, country)
+
+	_, ok = Lookup("XK")
+	assert.True(t, ok, "SWIFT uses XK for Kosovo")
+	_, ok = Lookup("QQ")
+	assert.False(t, ok)
+
+	assert.Equal(t, "UNITED STATES", Name("us", "USA"))
+	assert.Equal(t, "NOWHERE", Name("QQ", "NOWHERE"))
+}
+
+// Tests that the embedded table has every ISO 3166-1 code once, in order.
+func TestAll(t *testing.T) {
+	list := All()
+	assert.Len(t, list, 250, "249 ISO 3166-1 codes and XK")
+	for i := 1; i < len(list); i++ {
+		assert.Less(t, list[i-1].ISO2, list[i].ISO2)
+	}
+	for _, country := range list {
+		assert.Equal(t, strings.ToUpper(country.Name), country.Name)
+	}
+
+	list[0].Name = "CHANGED"
+	assert.NotEqual(t, "CHANGED", All()[0].Name, "All should return a copy")
+}
+
+// Tests that a malformed table is rejected.
+func TestLoad(t *testing.T) {
+	_, err := load(strings.NewReader("countryISO2,countryName\nPL,POLAND\npl,POLAND\n"))
+	assert.Error(t, err)
+	_, err = load(strings.NewReader("countryISO2,countryName\nPL,POLAND\nPL,POLSKA\n"))
+	assert.ErrorContains(t, err, "duplicate")
+	_, err = load(strings.NewReader("countryISO2,countryName\nPL\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,307 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Driver names, also used as the directory names under migrations/.
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationLockID is the PostgreSQL advisory lock key held while migrating.
+const migrationLockID = 7305513
+
+const schemaMigrationsTable = `
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+      version INTEGER PRIMARY KEY,
+      name VARCHAR(255) NOT NULL,
+      applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+    `
+
+// Migration is one versioned schema change, read from a pair of
+// NNNN_name.up.sql / NNNN_name.down.sql files.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes a migration and whether it was applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	// Unknown is set for versions recorded in the database that this binary does not ship.
+	Unknown bool
+}
+
+// Migrator applies and rolls back the migrations of one driver.
+//
+// Every migration runs in its own transaction together with its
+// schema_migrations row. On PostgreSQL the whole run holds an advisory lock,
+// so a second instance waits until the first one is done. SQLite has no such
+// lock; there transactions are opened with BEGIN IMMEDIATE (see ConnectSQLite)
+// and the applied state is re-checked inside each one.
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB, driver string) (*Migrator, error) {
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, driver: driver, migrations: migrations}, nil
+}
+
+// Migrate applies all pending migrations.
+func Migrate(db *sql.DB, driver string) error {
+	m, err := NewMigrator(db, driver)
+	if err != nil {
+		return err
+	}
+	_, err = m.Up()
+	return err
+}
+
+// Up applies all pending migrations in version order and returns the ones it applied.
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		for _, mig := range m.migrations {
+			ok, err := m.apply(ctx, conn, mig, true)
+			if err != nil {
+				return err
+			}
+			if ok {
+				applied = append(applied, mig)
+			}
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations and returns them.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			ok, err := m.apply(ctx, conn, mig, false)
+			if err != nil {
+				return err
+			}
+			if ok {
+				reverted = append(reverted, mig)
+			}
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration, plus versions found only in the database.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var result []MigrationStatus
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			status := MigrationStatus{Version: mig.Version, Name: mig.Name}
+			if row, ok := done[mig.Version]; ok {
+				status.AppliedAt = &row.AppliedAt
+				delete(done, mig.Version)
+			}
+			result = append(result, status)
+		}
+		for version, row := range done {
+			appliedAt := row.AppliedAt
+			result = append(result, MigrationStatus{Version: version, Name: row.Name, AppliedAt: &appliedAt, Unknown: true})
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+		return nil
+	})
+	return result, err
+}
+
+// Pending returns the number of migrations not applied yet.
+func (m *Migrator) Pending() (int, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// withLock runs fn on a dedicated connection after making sure the
+// schema_migrations table exists and, on PostgreSQL, taking the advisory lock.
+func (m *Migrator) withLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.driver == Postgres {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+	}
+
+	if _, err := conn.ExecContext(ctx, schemaMigrationsTable); err != nil {
+		return err
+	}
+	return fn(ctx, conn)
+}
+
+// apply runs mig up or down in a transaction. It returns false without doing
+// anything when the migration is already in the requested state.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration, up bool) (bool, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version = $1`, mig.Version).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	if (count > 0) == up {
+		return false, nil
+	}
+
+	script, record := mig.Down, `DELETE FROM schema_migrations WHERE version = $1`
+	var args []interface{}
+	if up {
+		script, record = mig.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+		args = []interface{}{mig.Version, mig.Name}
+	} else {
+		args = []interface{}{mig.Version}
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return false, fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+type appliedMigration struct {
+	Name      string
+	AppliedAt time.Time
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var row appliedMigration
+		if err := rows.Scan(&version, &row.Name, &row.AppliedAt); err != nil {
+			return nil, err
+		}
+		result[version] = row
+	}
+	return result, rows.Err()
+}
+
+func loadMigrations(driver string) ([]Migration, error) {
+	dir := "migrations/" + driver
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %q", driver)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var up bool
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			up = true
+		case strings.HasSuffix(name, ".down.sql"):
+			up = false
+		default:
+			return nil, fmt.Errorf("unexpected migration file %s", name)
+		}
+
+		base := strings.TrimSuffix(strings.TrimSuffix(name, ".up.sql"), ".down.sql")
+		versionPart, title, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionPart)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration file %s must be named NNNN_name.up.sql or NNNN_name.down.sql", name)
+		}
+
+		body, err := fs.ReadFile(migrationFiles, dir+"/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		mig, exists := byVersion[version]
+		if !exists {
+			mig = &Migration{Version: version, Name: title}
+			byVersion[version] = mig
+		} else if mig.Name != title {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, mig.Name, title)
+		}
+		if up {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", mig.Version, mig.Name)
+		}
+		result = append(result, *mig)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
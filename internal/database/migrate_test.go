@@ -0,0 +1,336 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that both drivers ship the same, well-formed list of migrations.
+func TestLoadMigrations(t *testing.T) {
+	pg, err := loadMigrations(Postgres)
+	require.NoError(t, err)
+	lite, err := loadMigrations(SQLite)
+	require.NoError(t, err)
+
+	require.Equal(t, len(pg), len(lite), "Every migration needs a PostgreSQL and a SQLite version")
+	for i := range pg {
+		assert.Equal(t, pg[i].Version, lite[i].Version)
+		assert.Equal(t, pg[i].Name, lite[i].Name)
+	}
+
+	_, err = loadMigrations("oracle")
+	assert.Error(t, err)
+}
+
+// Tests up, status and down on a fresh SQLite file.
+func TestMigrator_UpStatusDown(t *testing.T) {
+	db, err := ConnectSQLite(filepath.Join(t.TempDir(), "swift.db"), false)
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := NewMigrator(db, SQLite)
+	require.NoError(t, err)
+
+	pending, err := m.Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, len(m.migrations), pending, "Nothing should be applied on a fresh file")
+
+	applied, err := m.Up()
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(m.migrations))
+
+	applied, err = m.Up()
+	assert.NoError(t, err)
+	assert.Empty(t, applied, "A second run should be a no-op")
+
+	statuses, err := m.Status()
+	assert.NoError(t, err)
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedAt, "Migration %d should be applied", s.Version)
+	}
+
+	_, err = db.Exec(`SELECT COUNT(*) FROM swift_codes`)
+	assert.NoError(t, err, "swift_codes should exist after migrating")
+
+	reverted, err := m.Down(len(m.migrations))
+	assert.NoError(t, err)
+	assert.Len(t, reverted, len(m.migrations))
+
+	_, err = db.Exec(`SELECT COUNT(*) FROM swift_codes`)
+	assert.Error(t, err, "swift_codes should be dropped after rolling everything back")
+
+	pending, err = m.Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, len(m.migrations), pending)
+}
+
+// Tests that two processes opening and migrating a new file at once both
+// connect, switch it to WAL and apply each migration exactly once.
+func TestMigrator_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "swift.db")
+
+	var wg sync.WaitGroup
+	results := make([][]Migration, 2)
+	errs := make([]error, 2)
+	modes := make([]string, 2)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			db, err := ConnectSQLite(path, false)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer db.Close()
+			if err := db.QueryRow(`PRAGMA journal_mode`).Scan(&modes[i]); err != nil {
+				errs[i] = err
+				return
+			}
+			m, err := NewMigrator(db, SQLite)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			results[i], errs[i] = m.Up()
+		}(i)
+	}
+	wg.Wait()
+
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.Equal(t, []string{"wal", "wal"}, modes)
+
+	migrations, _ := loadMigrations(SQLite)
+	assert.Equal(t, len(migrations), len(results[0])+len(results[1]), "Each migration should be applied by exactly one of the runs")
+}
+
+// Tests that the town migration splits "address, TOWN" where possible and
+// that rolling it back joins them again.
+func TestMigration_SplitTown(t *testing.T) {
+	db, err := ConnectSQLite(filepath.Join(t.TempDir(), "swift.db"), false)
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := NewMigrator(db, SQLite)
+	require.NoError(t, err)
+	_, err = m.Up()
+	require.NoError(t, err)
+	for len(m.migrations) > 0 && m.migrations[len(m.migrations)-1].Name != "split_town" {
+		m.migrations = m.migrations[:len(m.migrations)-1]
+	}
+	_, err = m.Down(1)
+	require.NoError(t, err)
+
+	addresses := map[string]string{
+		"AAAAPLPWXXX": "UL. PUŁAWSKA 15, PIĘTRO 2, WARSZAWA",
+		"BBBBPLPWXXX": ", KRAKOW",
+		"CCCCPLPWXXX": "HAUPTSTRASSE, 12",
+		"DDDDPLPWXXX": "NO TOWN AT ALL",
+	}
+	for code, address := range addresses {
+		_, err := db.Exec(`INSERT INTO swift_codes (swift_code, bank_name, address, country_iso2, country_name, is_headquarter)
+			VALUES (?, 'BANK', ?, 'PL', 'POLAND', 1)`, code, address)
+		require.NoError(t, err)
+	}
+
+	_, err = m.Up()
+	require.NoError(t, err)
+
+	expected := map[string][2]string{
+		"AAAAPLPWXXX": {"UL. PUŁAWSKA 15, PIĘTRO 2", "WARSZAWA"},
+		"BBBBPLPWXXX": {"", "KRAKOW"},
+		"CCCCPLPWXXX": {"HAUPTSTRASSE, 12", ""},
+		"DDDDPLPWXXX": {"NO TOWN AT ALL", ""},
+	}
+	for code, want := range expected {
+		var address, town string
+		require.NoError(t, db.QueryRow(`SELECT address, town FROM swift_codes WHERE swift_code = ?`, code).Scan(&address, &town))
+		assert.Equal(t, want, [2]string{address, town}, code)
+	}
+
+	_, err = m.Down(1)
+	require.NoError(t, err)
+	var address string
+	require.NoError(t, db.QueryRow(`SELECT address FROM swift_codes WHERE swift_code = 'AAAAPLPWXXX'`).Scan(&address))
+	assert.Equal(t, addresses["AAAAPLPWXXX"], address)
+}
+
+// Tests that stored codes are trimmed and upper-cased, except ones whose
+// normalized form would clash with another row.
+func TestMigration_NormalizeSwiftCodes(t *testing.T) {
+	db, err := ConnectSQLite(filepath.Join(t.TempDir(), "swift.db"), false)
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := NewMigrator(db, SQLite)
+	require.NoError(t, err)
+	_, err = m.Up()
+	require.NoError(t, err)
+	for len(m.migrations) > 0 && m.migrations[len(m.migrations)-1].Name != "normalize_swift_codes" {
+		m.migrations = m.migrations[:len(m.migrations)-1]
+	}
+	_, err = m.Down(2)
+	require.NoError(t, err)
+
+	insert := `INSERT INTO swift_codes (swift_code, bank_name, address, country_iso2, country_name, is_headquarter)
+		VALUES (?, 'BANK', '', 'PL', 'POLAND', ?)`
+	for code, isHQ := range map[string]bool{"aaaaplpwxxx": true, " BBBBPLPW12": false, "ccccplpwxxx": true, "CCCCPLPWXXX": true} {
+		_, err = db.Exec(insert, code, isHQ)
+		require.NoError(t, err)
+	}
+
+	_, err = m.Up()
+	require.NoError(t, err)
+
+	var codes []string
+	rows, err := db.Query(`SELECT swift_code FROM swift_codes ORDER BY swift_code`)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var code string
+		require.NoError(t, rows.Scan(&code))
+		codes = append(codes, code)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"AAAAPLPWXXX", "BBBBPLPW12", "CCCCPLPWXXX", "ccccplpwxxx"}, codes)
+}
+
+// Tests that the headquarter check leaves existing rows alone but rejects new
+// rows, and updates keeping a row, whose flag contradicts the code.
+func TestMigration_HeadquarterCheck(t *testing.T) {
+	db, err := ConnectSQLite(filepath.Join(t.TempDir(), "swift.db"), false)
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := NewMigrator(db, SQLite)
+	require.NoError(t, err)
+	_, err = m.Up()
+	require.NoError(t, err)
+	for len(m.migrations) > 0 && m.migrations[len(m.migrations)-1].Name != "headquarter_check" {
+		m.migrations = m.migrations[:len(m.migrations)-1]
+	}
+	_, err = m.Down(1)
+	require.NoError(t, err)
+
+	insert := `INSERT INTO swift_codes (swift_code, bank_name, address, country_iso2, country_name, is_headquarter)
+		VALUES (?, 'BANK', '', 'PL', 'POLAND', ?)`
+	_, err = db.Exec(insert, "AAAAPLPWXXX", false)
+	require.NoError(t, err)
+
+	_, err = m.Up()
+	require.NoError(t, err)
+
+	_, err = db.Exec(insert, "BBBBPLPWXXX", false)
+	assert.ErrorContains(t, err, "swift_codes_headquarter_check")
+	_, err = db.Exec(insert, "BBBBPLPW123", true)
+	assert.ErrorContains(t, err, "swift_codes_headquarter_check")
+	_, err = db.Exec(insert, "bbbbplpwxxx", true)
+	assert.NoError(t, err, "The suffix should be matched ignoring case")
+
+	_, err = db.Exec(`UPDATE swift_codes SET address = 'NEW' WHERE swift_code = 'AAAAPLPWXXX'`)
+	assert.ErrorContains(t, err, "swift_codes_headquarter_check", "An inconsistent row must be repaired before it is changed")
+	_, err = db.Exec(`UPDATE swift_codes SET is_headquarter = 1 WHERE swift_code = 'AAAAPLPWXXX'`)
+	assert.NoError(t, err)
+
+	_, err = m.Down(1)
+	require.NoError(t, err)
+	_, err = db.Exec(insert, "CCCCPLPWXXX", false)
+	assert.NoError(t, err)
+}
+
+// Tests that the fuzzy search index is filled with the existing rows and
+// follows updates and deletes.
+func TestMigration_FuzzySearchIndex(t *testing.T) {
+	db, err := ConnectSQLite(filepath.Join(t.TempDir(), "swift.db"), false)
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := NewMigrator(db, SQLite)
+	require.NoError(t, err)
+	_, err = m.Up()
+	require.NoError(t, err)
+	for len(m.migrations) > 0 && m.migrations[len(m.migrations)-1].Name != "fuzzy_search_index" {
+		m.migrations = m.migrations[:len(m.migrations)-1]
+	}
+	_, err = m.Down(1)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`INSERT INTO swift_codes (swift_code, bank_name, address, country_iso2, country_name, is_headquarter)
+		VALUES ('AAAAPLPWXXX', 'Bank Śląski', 'KATOWICE', 'PL', 'POLAND', 1)`)
+	require.NoError(t, err)
+	_, err = m.Up()
+	require.NoError(t, err)
+
+	words := func() []string {
+		rows, err := db.Query(`SELECT word FROM swift_code_words ORDER BY word`)
+		require.NoError(t, err)
+		defer rows.Close()
+		var words []string
+		for rows.Next() {
+			var word string
+			require.NoError(t, rows.Scan(&word))
+			words = append(words, word)
+		}
+		require.NoError(t, rows.Err())
+		return words
+	}
+	assert.Equal(t, []string{"bank", "katowice", "slaski"}, words())
+	var trigrams int
+	require.NoError(t, db.QueryRow(`SELECT count(*) FROM swift_word_trigrams WHERE word = 'slaski'`).Scan(&trigrams))
+	assert.Equal(t, 7, trigrams)
+
+	_, err = db.Exec(`UPDATE swift_codes SET address = 'CHORZOW' WHERE swift_code = 'AAAAPLPWXXX'`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bank", "chorzow", "slaski"}, words())
+	require.NoError(t, db.QueryRow(`SELECT count(*) FROM swift_word_trigrams WHERE word = 'chorzow'`).Scan(&trigrams))
+	assert.Equal(t, 8, trigrams)
+
+	_, err = db.Exec(`DELETE FROM swift_codes`)
+	require.NoError(t, err)
+	assert.Empty(t, words())
+
+	_, err = m.Down(1)
+	require.NoError(t, err)
+}
+
+// Tests that the report summaries of stored import jobs are filled in
+// without the header and the rejected rows.
+func TestMigration_ImportReportSummary(t *testing.T) {
+	db, err := ConnectSQLite(filepath.Join(t.TempDir(), "swift.db"), false)
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := NewMigrator(db, SQLite)
+	require.NoError(t, err)
+	_, err = m.Up()
+	require.NoError(t, err)
+	for len(m.migrations) > 0 && m.migrations[len(m.migrations)-1].Name != "import_report_summary" {
+		m.migrations = m.migrations[:len(m.migrations)-1]
+	}
+	_, err = m.Down(1)
+	require.NoError(t, err)
+
+	insert := `INSERT INTO imports (id, file_name, mode, state, created_at, report) VALUES (?, 'codes.csv', 'insert', 'succeeded', CURRENT_TIMESTAMP, ?)`
+	_, err = db.Exec(insert, "a", `{"id":"a","header":["SWIFT CODE"],"totalRows":2,"accepted":1,"rejected":1,"rejections":[{"row":3}]}`)
+	require.NoError(t, err)
+	_, err = db.Exec(insert, "b", nil)
+	require.NoError(t, err)
+
+	_, err = m.Up()
+	require.NoError(t, err)
+
+	var summary sql.NullString
+	require.NoError(t, db.QueryRow(`SELECT report_summary FROM imports WHERE id = 'a'`).Scan(&summary))
+	assert.JSONEq(t, `{"id":"a","totalRows":2,"accepted":1,"rejected":1}`, summary.String)
+	require.NoError(t, db.QueryRow(`SELECT report_summary FROM imports WHERE id = 'b'`).Scan(&summary))
+	assert.False(t, summary.Valid)
+
+	_, err = m.Down(1)
+	require.NoError(t, err)
+}
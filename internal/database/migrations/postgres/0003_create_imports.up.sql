@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS imports (
+  id VARCHAR(32) PRIMARY KEY,
+  file_name VARCHAR(255) NOT NULL,
+  mode VARCHAR(16) NOT NULL,
+  state VARCHAR(16) NOT NULL,
+  rows_accepted INTEGER NOT NULL DEFAULT 0,
+  rows_written INTEGER NOT NULL DEFAULT 0,
+  result TEXT,
+  report TEXT,
+  error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL,
+  started_at TIMESTAMPTZ,
+  finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS imports_state_idx ON imports (state);
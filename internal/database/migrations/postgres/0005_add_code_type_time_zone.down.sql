@@ -0,0 +1,2 @@
+ALTER TABLE swift_codes DROP COLUMN time_zone;
+ALTER TABLE swift_codes DROP COLUMN code_type;
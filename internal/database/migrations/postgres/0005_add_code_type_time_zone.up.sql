@@ -0,0 +1,2 @@
+ALTER TABLE swift_codes ADD COLUMN code_type VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE swift_codes ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+ALTER TABLE swift_codes ADD COLUMN town VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE swift_codes ADD COLUMN postal_code VARCHAR(16) NOT NULL DEFAULT '';
+
+-- Imports used to store "address, TOWN". Move the last comma separated part
+-- to town when it has no digits, so house numbers are never taken for towns.
+UPDATE swift_codes
+SET town = upper(trim(substring(address FROM ',\s*([^,0-9\s][^,0-9]*)$'))),
+    address = trim(substring(address FROM '^(.*),\s*[^,0-9\s][^,0-9]*$'))
+WHERE town = '' AND address ~ ',\s*[^,0-9\s][^,0-9]*$';
+
+CREATE INDEX IF NOT EXISTS swift_codes_town_idx ON swift_codes (town);
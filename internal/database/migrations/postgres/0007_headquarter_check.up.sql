@@ -0,0 +1,6 @@
+-- Headquarters are exactly the codes ending in XXX. NOT VALID only checks rows
+-- written from now on; rows stored before are left to the repair-headquarters
+-- command, which fixes them and then validates the constraint.
+ALTER TABLE swift_codes
+  ADD CONSTRAINT swift_codes_headquarter_check
+  CHECK (is_headquarter = (upper(swift_code) LIKE '%XXX')) NOT VALID;
@@ -0,0 +1,13 @@
+-- Codes used to be stored as sent, while lookups now trim and upper-case the
+-- requested code. Normalize the stored ones, deriving the headquarter flag
+-- from the normalized code. A code whose normalized form is shared with
+-- another row is left as it is, rather than guessing which one to keep.
+UPDATE swift_codes
+SET swift_code = upper(trim(swift_code)),
+    is_headquarter = (upper(trim(swift_code)) LIKE '%XXX'),
+    version = version + 1
+WHERE swift_code <> upper(trim(swift_code))
+  AND NOT EXISTS (
+    SELECT 1 FROM swift_codes other
+    WHERE other.id <> swift_codes.id AND upper(trim(other.swift_code)) = upper(trim(swift_codes.swift_code))
+  );
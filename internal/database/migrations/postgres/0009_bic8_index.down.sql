@@ -0,0 +1 @@
+DROP INDEX IF EXISTS swift_codes_bic8_idx;
@@ -0,0 +1,2 @@
+-- Branches and batch lookups select codes by their first 8 characters.
+CREATE INDEX IF NOT EXISTS swift_codes_bic8_idx ON swift_codes (substr(swift_code, 1, 8));
@@ -0,0 +1,3 @@
+-- The extensions are left installed, other schemas may use them.
+DROP INDEX IF EXISTS swift_codes_search_idx;
+DROP FUNCTION IF EXISTS swift_fold(text);
@@ -0,0 +1,14 @@
+-- Fuzzy bank name search: trigram similarity over the bank name and address,
+-- ignoring case and diacritics. Creating the extensions needs a role allowed
+-- to do so, e.g. the database owner on PostgreSQL 13 or later.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- unaccent() is only STABLE, as its dictionary could change; naming the
+-- dictionary makes this wrapper safe to declare IMMUTABLE and to index.
+CREATE OR REPLACE FUNCTION swift_fold(text) RETURNS text
+  LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT
+  AS $$ SELECT lower(public.unaccent('public.unaccent'::regdictionary, $1)) $$;
+
+CREATE INDEX IF NOT EXISTS swift_codes_search_idx
+  ON swift_codes USING gin (swift_fold(bank_name || ' ' || address) gin_trgm_ops);
@@ -0,0 +1,4 @@
+-- The instance running an import job and when it last reported on it, so other
+-- instances can tell a running job from one left by a stopped instance.
+ALTER TABLE imports ADD COLUMN owner VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE imports ADD COLUMN heartbeat_at TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+-- SQLite only: PostgreSQL searches with the pg_trgm index of 0010_fuzzy_search,
+-- so there is no schema change.
+SELECT 1;
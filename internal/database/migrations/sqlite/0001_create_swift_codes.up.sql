@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS swift_codes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  swift_code VARCHAR(11) NOT NULL UNIQUE,
+  bank_name VARCHAR(255) NOT NULL,
+  address VARCHAR(255) NOT NULL,
+  country_iso2 VARCHAR(2) NOT NULL,
+  country_name VARCHAR(100) NOT NULL,
+  is_headquarter BOOLEAN NOT NULL
+);
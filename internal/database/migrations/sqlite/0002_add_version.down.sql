@@ -0,0 +1 @@
+ALTER TABLE swift_codes DROP COLUMN version;
@@ -0,0 +1 @@
+ALTER TABLE swift_codes ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS swift_codes_import_id_idx;
+ALTER TABLE swift_codes DROP COLUMN source_row;
+ALTER TABLE swift_codes DROP COLUMN import_id;
+
+DROP INDEX IF EXISTS imports_created_at_idx;
+ALTER TABLE imports DROP COLUMN uploader;
+ALTER TABLE imports DROP COLUMN checksum;
@@ -0,0 +1,7 @@
+ALTER TABLE imports ADD COLUMN checksum VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE imports ADD COLUMN uploader VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS imports_created_at_idx ON imports (created_at);
+
+ALTER TABLE swift_codes ADD COLUMN import_id VARCHAR(32);
+ALTER TABLE swift_codes ADD COLUMN source_row INTEGER;
+CREATE INDEX IF NOT EXISTS swift_codes_import_id_idx ON swift_codes (import_id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS swift_codes_town_idx;
+
+UPDATE swift_codes SET address = address || ', ' || town WHERE town <> '';
+
+ALTER TABLE swift_codes DROP COLUMN postal_code;
+ALTER TABLE swift_codes DROP COLUMN town;
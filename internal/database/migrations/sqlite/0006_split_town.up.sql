@@ -0,0 +1,16 @@
+ALTER TABLE swift_codes ADD COLUMN town VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE swift_codes ADD COLUMN postal_code VARCHAR(16) NOT NULL DEFAULT '';
+
+-- Imports used to store "address, TOWN". Move the last comma separated part
+-- to town when it has no digits, so house numbers are never taken for towns.
+-- rtrim(address, <every character but the comma>) keeps address up to its
+-- last comma, SQLite having no regular expressions.
+UPDATE swift_codes
+SET town = upper(trim(substr(address, length(rtrim(address, replace(address, ',', ''))) + 1))),
+    address = trim(substr(address, 1, length(rtrim(address, replace(address, ',', ''))) - 1))
+WHERE town = ''
+  AND instr(address, ',') > 0
+  AND trim(substr(address, length(rtrim(address, replace(address, ',', ''))) + 1)) <> ''
+  AND substr(address, length(rtrim(address, replace(address, ',', ''))) + 1) NOT GLOB '*[0-9]*';
+
+CREATE INDEX IF NOT EXISTS swift_codes_town_idx ON swift_codes (town);
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS swift_codes_headquarter_update;
+DROP TRIGGER IF EXISTS swift_codes_headquarter_insert;
@@ -0,0 +1,17 @@
+-- Headquarters are exactly the codes ending in XXX. SQLite cannot add a CHECK
+-- constraint to an existing table, so triggers check every row written from
+-- now on, like the NOT VALID constraint on PostgreSQL; rows stored before are
+-- left to the repair-headquarters command.
+CREATE TRIGGER swift_codes_headquarter_insert
+BEFORE INSERT ON swift_codes
+WHEN NEW.is_headquarter <> (upper(NEW.swift_code) LIKE '%XXX')
+BEGIN
+  SELECT RAISE(ABORT, 'swift_codes_headquarter_check: is_headquarter must be true exactly for codes ending in XXX');
+END;
+
+CREATE TRIGGER swift_codes_headquarter_update
+BEFORE UPDATE ON swift_codes
+WHEN NEW.is_headquarter <> (upper(NEW.swift_code) LIKE '%XXX')
+BEGIN
+  SELECT RAISE(ABORT, 'swift_codes_headquarter_check: is_headquarter must be true exactly for codes ending in XXX');
+END;
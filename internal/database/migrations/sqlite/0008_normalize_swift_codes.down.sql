@@ -0,0 +1,2 @@
+-- The codes as originally sent are not kept, so there is nothing to restore.
+SELECT 1;
@@ -0,0 +1,3 @@
+-- SQLite has no trigram extension; fuzzy search results are ranked by the
+-- application (internal/fuzzy), so there is no schema change.
+SELECT 1;
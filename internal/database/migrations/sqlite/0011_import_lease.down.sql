@@ -0,0 +1,2 @@
+ALTER TABLE imports DROP COLUMN heartbeat_at;
+ALTER TABLE imports DROP COLUMN owner;
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS swift_codes_search_delete;
+DROP TRIGGER IF EXISTS swift_codes_search_update;
+DROP TABLE IF EXISTS swift_word_trigrams;
+DROP TABLE IF EXISTS swift_code_words;
@@ -0,0 +1,50 @@
+-- Index for fuzzy search on SQLite, which has no pg_trgm. The trigrams of a
+-- text are those of its words (see internal/fuzzy), so the index holds the
+-- folded words of every bank name and address and the trigrams of every word;
+-- a search only ranks the codes sharing enough trigrams with the query.
+-- Words no code uses any more stay in swift_word_trigrams, matching nothing.
+-- Updates and deletes are indexed by the triggers below; inserts only come
+-- from imports, which index the new codes in one statement (see
+-- stagedImport.merge) rather than with a trigger per row.
+-- swift_words() and swift_trigrams() are registered by the application on
+-- every connection (internal/database): other SQLite clients can read the
+-- database but not update swift_codes.
+CREATE TABLE swift_code_words (
+  word TEXT NOT NULL,
+  code_id INTEGER NOT NULL,
+  PRIMARY KEY (word, code_id)
+) WITHOUT ROWID;
+
+CREATE INDEX swift_code_words_code_idx ON swift_code_words (code_id);
+
+CREATE TABLE swift_word_trigrams (
+  trigram TEXT NOT NULL,
+  word TEXT NOT NULL,
+  PRIMARY KEY (trigram, word)
+) WITHOUT ROWID;
+
+CREATE INDEX swift_word_trigrams_word_idx ON swift_word_trigrams (word);
+
+CREATE TRIGGER swift_codes_search_update AFTER UPDATE OF bank_name, address ON swift_codes
+WHEN OLD.bank_name <> NEW.bank_name OR OLD.address <> NEW.address
+BEGIN
+  DELETE FROM swift_code_words WHERE code_id = OLD.id;
+  INSERT INTO swift_code_words (word, code_id)
+  SELECT value, NEW.id FROM json_each(swift_words(NEW.bank_name || ' ' || NEW.address));
+  INSERT INTO swift_word_trigrams (trigram, word)
+  SELECT t.value, w.word
+  FROM swift_code_words w, json_each(swift_trigrams(w.word)) t
+  WHERE w.code_id = NEW.id AND NOT EXISTS (SELECT 1 FROM swift_word_trigrams k WHERE k.word = w.word);
+END;
+
+CREATE TRIGGER swift_codes_search_delete AFTER DELETE ON swift_codes
+BEGIN
+  DELETE FROM swift_code_words WHERE code_id = OLD.id;
+END;
+
+INSERT INTO swift_code_words (word, code_id)
+SELECT w.value, c.id FROM swift_codes c, json_each(swift_words(c.bank_name || ' ' || c.address)) w;
+
+INSERT INTO swift_word_trigrams (trigram, word)
+SELECT t.value, v.word
+FROM (SELECT DISTINCT word FROM swift_code_words) v, json_each(swift_trigrams(v.word)) t;
@@ -0,0 +1,7 @@
+-- The report of an import job without its header and rejected rows, which
+-- can be thousands, so that the import history need not read the reports.
+ALTER TABLE imports ADD COLUMN report_summary TEXT;
+
+UPDATE imports
+SET report_summary = json_remove(report, '$.header', '$.rejections')
+WHERE report IS NOT NULL;
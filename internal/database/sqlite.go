@@ -0,0 +1,101 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/fuzzy"
+	"github.com/mattn/go-sqlite3"
+)
+
+// busyTimeout is how long a connection waits for another one's lock.
+const busyTimeout = 5 * time.Second
+
+// sqliteDriver is go-sqlite3 with the functions the schema relies on:
+// swift_words and swift_trigrams fill the fuzzy search index (see migration
+// 0012_fuzzy_search_index), as JSON arrays for json_each.
+const sqliteDriver = "sqlite3_swift"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("swift_words", jsonOf(fuzzy.Words), true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("swift_trigrams", jsonOf(fuzzy.Trigrams), true)
+		},
+	})
+}
+
+// jsonOf returns fn with its result encoded as a JSON array.
+func jsonOf(fn func(string) []string) func(string) (string, error) {
+	return func(text string) (string, error) {
+		encoded, err := json.Marshal(fn(text))
+		return string(encoded), err
+	}
+}
+
+// ConnectSQLite opens the SQLite file at path without touching the schema.
+// Unless readOnly is set, the file is created when missing.
+func ConnectSQLite(path string, readOnly bool) (*sql.DB, error) {
+	params := url.Values{}
+	params.Set("_busy_timeout", strconv.Itoa(int(busyTimeout/time.Millisecond)))
+	params.Set("_foreign_keys", "on")
+	// Transactions take the write lock up front, which is what keeps two
+	// processes from applying the same migration (see Migrator).
+	params.Set("_txlock", "immediate")
+	if readOnly {
+		params.Set("mode", "ro")
+	} else {
+		params.Set("mode", "rwc")
+	}
+	dsn := fmt.Sprintf("file:%s?%s", path, params.Encode())
+
+	db, err := sql.Open(sqliteDriver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err == nil && !readOnly {
+		err = enableWAL(db)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// enableWAL switches the file to write-ahead logging, which is kept in the
+// file. Processes opening a new file at the same time race on the switch and
+// SQLite reports the loser as busy at once, without waiting for the busy
+// timeout, so it is retried for as long as that timeout.
+func enableWAL(db *sql.DB) error {
+	deadline := time.Now().Add(busyTimeout)
+	for {
+		_, err := db.Exec(`PRAGMA journal_mode = WAL`)
+		var sqliteErr sqlite3.Error
+		busy := errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+		if !busy || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// ConnectAndMigrateSQLite opens (or creates) the SQLite file and applies all pending migrations.
+func ConnectAndMigrateSQLite(path string) (*sql.DB, error) {
+	db, err := ConnectSQLite(path, false)
+	if err != nil {
+		return nil, err
+	}
+	if err = Migrate(db, SQLite); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
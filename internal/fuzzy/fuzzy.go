@@ -0,0 +1,140 @@
+// Package fuzzy scores how well a search text matches a stored text, the way
+// PostgreSQL's pg_trgm and unaccent extensions do, for storage without them.
+package fuzzy
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// letters that do not decompose into a base letter and an accent, spelled
+// like unaccent does.
+var letters = strings.NewReplacer(
+	"ł", "l", "Ł", "L", "đ", "d", "Đ", "D", "ø", "o", "Ø", "O", "ß", "ss",
+	"æ", "ae", "Æ", "AE", "œ", "oe", "Œ", "OE", "ı", "i", "þ", "th", "Þ", "TH",
+)
+
+// Fold lower-cases s and removes its diacritics, e.g. "Łódź" gives "lodz".
+func Fold(s string) string {
+	if isASCII(s) {
+		return strings.ToLower(s)
+	}
+	stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), s)
+	if err != nil {
+		stripped = s
+	}
+	return strings.ToLower(letters.Replace(stripped))
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// words returns the folded words of s in order.
+func words(s string) []string {
+	return strings.FieldsFunc(Fold(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigrams returns the trigrams of the folded words of s in order, each word
+// padded with two spaces before and one after, as pg_trgm does.
+func trigrams(s string) []string {
+	var result []string
+	for _, word := range words(s) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			result = append(result, string(padded[i:i+3]))
+		}
+	}
+	return result
+}
+
+// WordSimilarity returns, between 0 and 1, the greatest similarity between
+// the trigrams of query and those of any continuous part of text, ignoring
+// case and diacritics, like pg_trgm's word_similarity(query, text).
+func WordSimilarity(query, text string) float64 {
+	wanted := make(map[string]bool)
+	for _, trigram := range trigrams(query) {
+		wanted[trigram] = true
+	}
+	if len(wanted) == 0 {
+		return 0
+	}
+
+	// The best part starts and ends with a wanted trigram: widening a part
+	// by others only grows the union.
+	found := trigrams(text)
+	best := 0.0
+	for start := range found {
+		if !wanted[found[start]] {
+			continue
+		}
+		seen := make(map[string]bool)
+		common, union := 0, len(wanted)
+		for end := start; end < len(found); end++ {
+			trigram := found[end]
+			if !seen[trigram] {
+				seen[trigram] = true
+				if wanted[trigram] {
+					common++
+				} else {
+					union++
+				}
+			}
+			if wanted[trigram] {
+				if score := float64(common) / float64(union); score > best {
+					best = score
+				}
+			}
+		}
+	}
+	return best
+}
+
+// Words returns the distinct folded words of s. The trigrams of a text are
+// those of its words taken one by one, so a search index can store the words
+// of every text and the trigrams of every word.
+func Words(s string) []string {
+	return distinct(words(s))
+}
+
+// Trigrams returns the distinct trigrams of s that WordSimilarity compares.
+func Trigrams(s string) []string {
+	return distinct(trigrams(s))
+}
+
+// MinShared returns how many of the n distinct trigrams of a query a text
+// must contain to score at least minScore, and above 0: the score is the
+// common share of a union holding at least those n trigrams. Texts with
+// fewer of them can be left out before scoring.
+func MinShared(n int, minScore float64) int {
+	shared := int(math.Ceil(minScore*float64(n) - 1e-9))
+	if shared < 1 {
+		return 1
+	}
+	return shared
+}
+
+func distinct(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
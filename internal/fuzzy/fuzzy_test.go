@@ -0,0 +1,71 @@
+package fuzzy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests that folding removes case and diacritics, also from letters that do not decompose.
+func TestFold(t *testing.T) {
+	assert.Equal(t, "lodz", Fold("Łódź"))
+	assert.Equal(t, "bank polska kasa opieki", Fold("BANK POLSKA KASA OPIEKI"))
+	assert.Equal(t, "strasse zurich", Fold("STRAßE ZÜRICH"))
+}
+
+// Tests that a query scores by how well it matches the closest part of the text.
+func TestWordSimilarity(t *testing.T) {
+	name := "BANK POLSKA KASA OPIEKI SA"
+	assert.Equal(t, 1.0, WordSimilarity("bank polska kasa opieki", name))
+	assert.Equal(t, 1.0, WordSimilarity("Kasa Opieki", name), "Any part of the text can match")
+	assert.Equal(t, 1.0, WordSimilarity("ŁÓDŹ", "UL. PIOTRKOWSKA 3 LODZ"))
+
+	typo := WordSimilarity("bank polsak kasa opeki", name)
+	assert.Greater(t, typo, 0.5)
+	assert.Less(t, typo, 1.0)
+
+	assert.Less(t, WordSimilarity("deutsche bank", name), typo)
+	assert.Equal(t, 0.0, WordSimilarity("zzzz", name))
+	assert.Equal(t, 0.0, WordSimilarity("", name))
+	assert.Equal(t, 0.0, WordSimilarity("bank", ""))
+}
+
+// Tests that every text scoring at least minScore shares MinShared trigrams
+// with the query, so that a search index may leave out the texts with fewer,
+// and that the trigrams of a text are those of its words.
+func TestMinShared(t *testing.T) {
+	assert.Equal(t, []string{"lodz", "ul"}, Words("ŁÓDŹ, ul. Łódź UL"))
+	assert.Equal(t, []string{"  l", " lo", "lod", "odz", "dz "}, Trigrams("ŁÓDŹ lodz"))
+	assert.Equal(t, 1, MinShared(5, 0))
+	assert.Equal(t, 2, MinShared(5, 0.3))
+	assert.Equal(t, 3, MinShared(10, 0.3))
+
+	texts := []string{"BANK POLSKA KASA OPIEKI SA", "POWSZECHNA KASA OSZCZEDNOSCI BANK POLSKI", "DEUTSCHE BANK", "BAR", "UL. PIOTRKOWSKA 3 LODZ"}
+	for _, text := range texts {
+		var byWord []string
+		for _, word := range Words(text) {
+			byWord = append(byWord, Trigrams(word)...)
+		}
+		assert.ElementsMatch(t, Trigrams(text), distinct(byWord), text)
+	}
+
+	for _, query := range []string{"bank", "bank polsak kasa opeki", "lodz", "ba", "kasa"} {
+		wanted := make(map[string]bool)
+		for _, trigram := range Trigrams(query) {
+			wanted[trigram] = true
+		}
+		for _, text := range texts {
+			shared := 0
+			for _, trigram := range Trigrams(text) {
+				if wanted[trigram] {
+					shared++
+				}
+			}
+			for _, minScore := range []float64{0.1, 0.3, 0.5, 0.9} {
+				if WordSimilarity(query, text) >= minScore {
+					assert.GreaterOrEqual(t, shared, MinShared(len(wanted), minScore), "%q in %q", query, text)
+				}
+			}
+		}
+	}
+}
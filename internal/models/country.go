@@ -0,0 +1,25 @@
+package models
+
+// CountrySummary counts the stored SWIFT codes of one country.
+type CountrySummary struct {
+	CountryISO2  string `json:"countryISO2"`
+	CountryName  string `json:"countryName"`
+	Headquarters int    `json:"headquarters"`
+	Branches     int    `json:"branches"`
+}
+
+// CountryTree holds the SWIFT codes of one country with every branch nested
+// under its headquarter, the code sharing its first 8 characters.
+type CountryTree struct {
+	CountryISO2  string                `json:"countryISO2"`
+	CountryName  string                `json:"countryName"`
+	Headquarters []HeadquarterBranches `json:"headquarters"`
+	// Orphans are the branches whose headquarter is not stored.
+	Orphans []SwiftCodeData `json:"orphans"`
+}
+
+// HeadquarterBranches is a headquarter's record with its branches.
+type HeadquarterBranches struct {
+	SwiftCodeData
+	Branches []SwiftCodeData `json:"branches"`
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ImportMode decides what an import does with codes that are already stored.
+type ImportMode string
+
+const (
+	// ImportInsert only adds new codes; stored codes are left untouched.
+	ImportInsert ImportMode = "insert"
+	// ImportUpsert adds new codes and updates stored codes whose data changed.
+	ImportUpsert ImportMode = "upsert"
+	// ImportReplace empties the table and loads the file as it is.
+	ImportReplace ImportMode = "replace"
+	// ImportSync works like ImportUpsert and also deletes stored codes missing from the file.
+	ImportSync ImportMode = "sync"
+)
+
+// ParseImportMode validates a mode coming from a request. An empty string means ImportInsert.
+func ParseImportMode(value string) (ImportMode, error) {
+	switch mode := ImportMode(value); mode {
+	case "":
+		return ImportInsert, nil
+	case ImportInsert, ImportUpsert, ImportReplace, ImportSync:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown import mode %q (use insert, upsert, replace or sync)", value)
+	}
+}
+
+// ImportResult counts what an import did with each row.
+type ImportResult struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	// Skipped counts stored codes whose data differs but which ImportInsert left as they were.
+	Skipped int `json:"skipped"`
+	Deleted int `json:"deleted"`
+}
+
+// MaxRejections bounds the rejections an ImportReport keeps, so a large file
+// full of bad rows does not fill memory. Rejected still counts them all.
+const MaxRejections = 10000
+
+// ImportReport describes how the rows of an import file were handled.
+type ImportReport struct {
+	ID       string `json:"id"`
+	FileName string `json:"fileName"`
+	// Header is the file's header row, kept to rebuild the rejected rows as a spreadsheet.
+	Header    []string `json:"header"`
+	TotalRows int      `json:"totalRows"`
+	Accepted  int      `json:"accepted"`
+	Rejected  int      `json:"rejected"`
+	// Rejections are the first MaxRejections rejected rows, in row order.
+	Rejections []RowRejection `json:"rejections"`
+}
+
+// RowRejection explains why one row of an import file was not imported.
+type RowRejection struct {
+	// Row is the 1-based row number in the sheet, header included.
+	Row int `json:"row"`
+	// Column is the header of the offending column, empty when the row as a whole is invalid.
+	Column string   `json:"column"`
+	Reason string   `json:"reason"`
+	Values []string `json:"values"`
+}
+
+// Reject records a rejected row.
+func (r *ImportReport) Reject(rejection RowRejection) {
+	r.Rejected++
+	if len(r.Rejections) < MaxRejections {
+		r.Rejections = append(r.Rejections, rejection)
+	}
+}
+
+// Summary returns a copy of r without the header and the rejected rows, as
+// listed in the import history.
+func (r *ImportReport) Summary() *ImportReport {
+	summary := *r
+	summary.Header = nil
+	summary.Rejections = nil
+	return &summary
+}
+
+// RejectAccepted moves rows counted as accepted to the rejected ones, when
+// a check made after parsing, like the one for duplicates, turned them down.
+// rejected holds them, recorded with Reject.
+func (r *ImportReport) RejectAccepted(rejected *ImportReport) {
+	if rejected.Rejected == 0 {
+		return
+	}
+	r.Accepted -= rejected.Rejected
+	r.Rejected += rejected.Rejected
+
+	merged := append(r.Rejections, rejected.Rejections...)
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Row < merged[j].Row })
+	if len(merged) > MaxRejections {
+		merged = merged[:MaxRejections]
+	}
+	r.Rejections = merged
+}
+
+// ImportDiff previews what an import would change, without writing anything.
+type ImportDiff struct {
+	// Summary counts the net effect on the stored data.
+	Summary ImportResult `json:"summary"`
+	// Added are codes in the file that are not stored yet.
+	Added []SwiftCodeData `json:"added"`
+	// Changed are stored codes the import would update.
+	Changed []SwiftCodeChange `json:"changed"`
+	// Skipped are stored codes that differ from the file but stay as they are in insert mode.
+	Skipped []SwiftCodeChange `json:"skipped"`
+	// Removed are stored codes the import would delete.
+	Removed []string `json:"removed"`
+}
+
+// SwiftCodeChange lists the field changes of one stored code.
+type SwiftCodeChange struct {
+	SwiftCode string        `json:"swiftCode"`
+	Fields    []FieldChange `json:"fields"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// ImportState is the stage of a background import job.
+type ImportState string
+
+const (
+	ImportQueued    ImportState = "queued"
+	ImportRunning   ImportState = "running"
+	ImportSucceeded ImportState = "succeeded"
+	ImportFailed    ImportState = "failed"
+	// ImportCancelled jobs were stopped on request and rolled back.
+	ImportCancelled ImportState = "cancelled"
+)
+
+// Finished tells whether a job in this state will not change any more.
+func (s ImportState) Finished() bool {
+	return s == ImportSucceeded || s == ImportFailed || s == ImportCancelled
+}
+
+// ImportJob is an import running, or having run, in the background. Finished
+// jobs stay stored as the history of imports.
+type ImportJob struct {
+	ID       string `json:"id"`
+	FileName string `json:"fileName"`
+	// Checksum is the hex SHA-256 of the uploaded file or body.
+	Checksum string `json:"checksum"`
+	// Uploader identifies who sent the import.
+	Uploader string         `json:"uploader"`
+	Mode     ImportMode     `json:"mode"`
+	State    ImportState    `json:"state"`
+	Progress ImportProgress `json:"progress"`
+	// Result and Report are set once the job succeeded.
+	Result *ImportResult `json:"result,omitempty"`
+	Report *ImportReport `json:"report,omitempty"`
+	// Error says why a job failed.
+	Error string `json:"error,omitempty"`
+	// Owner is the server instance running the job, which stores a heartbeat
+	// at HeartbeatAt while it runs.
+	Owner       string     `json:"owner,omitempty"`
+	HeartbeatAt *time.Time `json:"heartbeatAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+}
+
+// ImportProgress counts the rows of a job handled so far.
+type ImportProgress struct {
+	// RowsAccepted counts the valid rows parsed.
+	RowsAccepted int `json:"rowsAccepted"`
+	// RowsWritten counts the accepted rows sent to the database. They only
+	// become visible when the whole job succeeds.
+	RowsWritten int `json:"rowsWritten"`
+}
@@ -1,11 +1,185 @@
 package models
 
+import (
+	"strings"
+	"time"
+
+	// Embedded so time zones validate the same on every host.
+	_ "time/tzdata"
+)
+
 type SwiftCodeData struct {
-	ID            int64  `json:"-"`
-	SwiftCode     string `json:"swiftCode"`
-	BankName      string `json:"bankName"`
-	Address       string `json:"address"`
+	ID        int64  `json:"-"`
+	SwiftCode string `json:"swiftCode"`
+	BankName  string `json:"bankName"`
+	Address   string `json:"address"`
+	// Town and PostalCode are kept apart from Address, upper-cased.
+	Town          string `json:"town"`
+	PostalCode    string `json:"postalCode"`
 	CountryISO2   string `json:"countryISO2"`
 	CountryName   string `json:"countryName"`
 	IsHeadquarter bool   `json:"isHeadquarter"`
+	// CodeType is the kind of code as given by the directory, e.g. BIC11.
+	CodeType string `json:"codeType"`
+	// TimeZone is the IANA time zone of the bank, e.g. Europe/Warsaw.
+	TimeZone string `json:"timeZone"`
+	// Version is bumped on every update and exposed as the ETag.
+	Version int64 `json:"-"`
+	// ImportID is the import that last wrote the record, empty when it was
+	// last written through the API. SourceRow is its row in that import.
+	ImportID  string `json:"importId,omitempty"`
+	SourceRow int    `json:"sourceRow,omitempty"`
+}
+
+// ScoredSwiftCode is a search result with its relevance, from 0 to 1.
+type ScoredSwiftCode struct {
+	SwiftCodeData
+	Score float64 `json:"score"`
+}
+
+// Headquarter is a headquarter's record with its number of branches.
+type Headquarter struct {
+	SwiftCodeData
+	BranchCount int `json:"branchCount"`
+}
+
+// SameData reports whether both records hold the same data, ignoring ID,
+// Version and where the data came from.
+func (sc SwiftCodeData) SameData(other SwiftCodeData) bool {
+	return sc.SwiftCode == other.SwiftCode && len(sc.FieldChanges(other)) == 0
+}
+
+// FieldChange is one field that differs between a stored record and new data.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// FieldChanges lists the data fields that would change if sc were replaced by newer.
+// Fields are named as in the JSON representation.
+func (sc SwiftCodeData) FieldChanges(newer SwiftCodeData) []FieldChange {
+	var changes []FieldChange
+	addString := func(field, old, new string) {
+		if old != new {
+			changes = append(changes, FieldChange{Field: field, Old: old, New: new})
+		}
+	}
+	addString("bankName", sc.BankName, newer.BankName)
+	addString("address", sc.Address, newer.Address)
+	addString("town", sc.Town, newer.Town)
+	addString("postalCode", sc.PostalCode, newer.PostalCode)
+	addString("countryISO2", sc.CountryISO2, newer.CountryISO2)
+	addString("countryName", sc.CountryName, newer.CountryName)
+	if sc.IsHeadquarter != newer.IsHeadquarter {
+		changes = append(changes, FieldChange{Field: "isHeadquarter", Old: sc.IsHeadquarter, New: newer.IsHeadquarter})
+	}
+	addString("codeType", sc.CodeType, newer.CodeType)
+	addString("timeZone", sc.TimeZone, newer.TimeZone)
+	return changes
+}
+
+// IsHeadquarterCode reports whether code is a headquarter's: headquarters are
+// exactly the codes whose branch code is "XXX".
+func IsHeadquarterCode(code string) bool {
+	return strings.HasSuffix(strings.ToUpper(code), "XXX")
+}
+
+// NormalizeSwiftCode trims and upper-cases a SWIFT code, the form in which
+// codes are stored and looked up.
+func NormalizeSwiftCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Forms in which a requested SWIFT code can match a stored one.
+const (
+	// MatchExact is a normalized code equal to a stored one.
+	MatchExact = "exact"
+	// MatchBIC8 is an 8-character code resolved to its XXX headquarter.
+	MatchBIC8 = "bic8"
+)
+
+// CodeMatch tells how a requested SWIFT code was matched: the code as
+// requested, its normalized form, the stored code it matched and the form.
+type CodeMatch struct {
+	Requested  string `json:"requestedCode"`
+	Normalized string `json:"normalizedCode"`
+	Matched    string `json:"matchedCode"`
+	Form       string `json:"matchedForm"`
+}
+
+// NormalizeCodeType trims and upper-cases a code type, e.g. " bic11" to "BIC11".
+func NormalizeCodeType(codeType string) string {
+	return strings.ToUpper(strings.TrimSpace(codeType))
+}
+
+// NormalizeTown trims and upper-cases a town, as towns are stored and filtered.
+func NormalizeTown(town string) string {
+	return strings.ToUpper(strings.TrimSpace(town))
+}
+
+// NormalizePostalCode trims and upper-cases a postal code.
+func NormalizePostalCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidTimeZone reports whether name is empty or an IANA time zone name.
+func ValidTimeZone(name string) bool {
+	if name == "" {
+		return true
+	}
+	if name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// SwiftCodePatch holds the fields of a partial update; nil fields are left unchanged.
+type SwiftCodePatch struct {
+	Address       *string `json:"address"`
+	Town          *string `json:"town"`
+	PostalCode    *string `json:"postalCode"`
+	BankName      *string `json:"bankName"`
+	CountryISO2   *string `json:"countryISO2"`
+	CountryName   *string `json:"countryName"`
+	IsHeadquarter *bool   `json:"isHeadquarter"`
+	CodeType      *string `json:"codeType"`
+	TimeZone      *string `json:"timeZone"`
+}
+
+func (p SwiftCodePatch) IsEmpty() bool {
+	return p.Address == nil && p.Town == nil && p.PostalCode == nil && p.BankName == nil && p.CountryISO2 == nil &&
+		p.CountryName == nil && p.IsHeadquarter == nil && p.CodeType == nil && p.TimeZone == nil
+}
+
+// Apply copies the set fields onto sc.
+func (p SwiftCodePatch) Apply(sc *SwiftCodeData) {
+	if p.Address != nil {
+		sc.Address = *p.Address
+	}
+	if p.Town != nil {
+		sc.Town = *p.Town
+	}
+	if p.PostalCode != nil {
+		sc.PostalCode = *p.PostalCode
+	}
+	if p.BankName != nil {
+		sc.BankName = *p.BankName
+	}
+	if p.CountryISO2 != nil {
+		sc.CountryISO2 = *p.CountryISO2
+	}
+	if p.CountryName != nil {
+		sc.CountryName = *p.CountryName
+	}
+	if p.IsHeadquarter != nil {
+		sc.IsHeadquarter = *p.IsHeadquarter
+	}
+	if p.CodeType != nil {
+		sc.CodeType = *p.CodeType
+	}
+	if p.TimeZone != nil {
+		sc.TimeZone = *p.TimeZone
+	}
 }
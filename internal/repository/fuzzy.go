@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/fuzzy"
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+)
+
+// searchText is what a fuzzy search matches, also indexed on PostgreSQL.
+func searchText(sc models.SwiftCodeData) string {
+	return sc.BankName + " " + sc.Address
+}
+
+// rankFuzzy scores records in Go, for storage without pg_trgm. It follows
+// the PostgreSQL ranking, though scores may differ slightly.
+func rankFuzzy(records []models.SwiftCodeData, q FuzzyQuery) []models.ScoredSwiftCode {
+	ranked := []models.ScoredSwiftCode{}
+	for _, sc := range records {
+		if len(q.Countries) > 0 && !containsString(q.Countries, sc.CountryISO2) {
+			continue
+		}
+		score := fuzzy.WordSimilarity(q.Text, searchText(sc))
+		if score > 0 && score >= q.MinScore {
+			ranked = append(ranked, models.ScoredSwiftCode{SwiftCodeData: sc, Score: score})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].SwiftCode < ranked[j].SwiftCode
+	})
+	if len(ranked) > q.Limit {
+		ranked = ranked[:q.Limit]
+	}
+	return ranked
+}
+
+// FuzzySearch only reads the records sharing enough trigrams with q.Text to
+// reach q.MinScore, found through the swift_code_words and
+// swift_word_trigrams index (see migration 0012_fuzzy_search_index), and
+// ranks them with rankFuzzy.
+func (r *SQLiteRepository) FuzzySearch(q FuzzyQuery) ([]models.ScoredSwiftCode, error) {
+	trigrams := fuzzy.Trigrams(q.Text)
+	if len(trigrams) == 0 {
+		return []models.ScoredSwiftCode{}, nil
+	}
+
+	args := []interface{}{fuzzy.MinShared(len(trigrams), q.MinScore)}
+	for _, trigram := range trigrams {
+		args = append(args, trigram)
+	}
+	query := `
+      SELECT ` + selectColumns + `
+      FROM swift_codes
+      WHERE id IN (
+        SELECT w.code_id
+        FROM swift_word_trigrams t
+        JOIN swift_code_words w ON w.word = t.word
+        WHERE t.trigram IN (` + placeholders(2, len(trigrams)) + `)
+        GROUP BY w.code_id
+        HAVING count(DISTINCT t.trigram) >= $1
+      )`
+	if len(q.Countries) > 0 {
+		query += ` AND country_iso2 IN (` + placeholders(len(args)+1, len(q.Countries)) + `)`
+		for _, iso2 := range q.Countries {
+			args = append(args, iso2)
+		}
+	}
+	rows, err := r.db.Query(r.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	records, err := scanSwiftCodes(rows)
+	if err != nil {
+		return nil, err
+	}
+	return rankFuzzy(records, q), nil
+}
+
+// FuzzySearch ranks with pg_trgm's word_similarity over the unaccented bank
+// name and address, which swift_codes_search_idx indexes (see migration
+// 0010_fuzzy_search). The <% operator uses the index, with q.MinScore as its
+// threshold for this transaction only.
+func (r *PostgresRepository) FuzzySearch(q FuzzyQuery) ([]models.ScoredSwiftCode, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`,
+		strconv.FormatFloat(q.MinScore, 'f', -1, 64)); err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{q.Text, q.Limit}
+	query := `
+      SELECT ` + selectColumns + `, word_similarity(swift_fold($1), swift_fold(bank_name || ' ' || address)) AS score
+      FROM swift_codes
+      WHERE swift_fold($1) <% swift_fold(bank_name || ' ' || address)`
+	if len(q.Countries) > 0 {
+		for _, iso2 := range q.Countries {
+			args = append(args, iso2)
+		}
+		query += ` AND country_iso2 IN (` + placeholders(3, len(q.Countries)) + `)`
+	}
+	query += `
+      ORDER BY score DESC, swift_code
+      LIMIT $2`
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ranked := []models.ScoredSwiftCode{}
+	for rows.Next() {
+		var result models.ScoredSwiftCode
+		result.SwiftCodeData, err = scanSwiftCode(extraColumn{rows, &result.Score})
+		if err != nil {
+			return nil, err
+		}
+		ranked = append(ranked, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ranked, tx.Commit()
+}
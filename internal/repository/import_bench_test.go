@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/database"
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+)
+
+// benchRows is the size of a full directory file, roughly.
+const benchRows = 100000
+
+func benchRecords(n int) []models.SwiftCodeData {
+	data := make([]models.SwiftCodeData, n)
+	for i := range data {
+		data[i] = models.SwiftCodeData{
+			SwiftCode:     fmt.Sprintf("B%05dPLXXX", i),
+			BankName:      fmt.Sprintf("BENCH BANK %d", i),
+			Address:       "UL. PROSTA 18, WARSZAWA",
+			CountryISO2:   "PL",
+			CountryName:   "POLAND",
+			IsHeadquarter: true,
+		}
+	}
+	return data
+}
+
+// benchmarkImport replaces the table with benchRows records on every
+// iteration, written in batches of 1000 like a file import, and reports rows/s.
+func benchmarkImport(b *testing.B, begin func(models.ImportMode) (ImportSession, error)) {
+	data := benchRecords(benchRows)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		session, err := begin(models.ImportReplace)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for start := 0; start < len(data); start += 1000 {
+			end := start + 1000
+			if end > len(data) {
+				end = len(data)
+			}
+			if _, err := session.Write(data[start:end]); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if _, err := session.Commit(); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(benchRows*b.N)/b.Elapsed().Seconds(), "rows/s")
+}
+
+func postgresBenchRepository(b *testing.B) *PostgresRepository {
+	db, err := database.ConnectAndMigrate("localhost", "myuser", "mysecretpassword", "swiftdb", "5432")
+	if err != nil {
+		b.Skipf("PostgreSQL not available: %v", err)
+	}
+	b.Cleanup(func() {
+		db.Exec("TRUNCATE swift_codes RESTART IDENTITY")
+		db.Close()
+	})
+	return NewPostgresRepository(db)
+}
+
+// Benchmarks the COPY + set-based merge import on PostgreSQL.
+func BenchmarkImport_PostgresCopy(b *testing.B) {
+	repo := postgresBenchRepository(b)
+	benchmarkImport(b, repo.BeginImport)
+}
+
+func BenchmarkImport_SQLite(b *testing.B) {
+	db, err := database.ConnectAndMigrateSQLite(filepath.Join(b.TempDir(), "swift.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	benchmarkImport(b, NewSQLiteRepository(db).BeginImport)
+}
+
+func BenchmarkImport_Memory(b *testing.B) {
+	benchmarkImport(b, NewMemoryRepository().BeginImport)
+}
@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+)
+
+const importColumns = `id, file_name, checksum, uploader, mode, state, rows_accepted, rows_written,
+  result, report, error, created_at, started_at, finished_at, owner, heartbeat_at`
+
+// importSummaryColumns are importColumns with the report summary, without the
+// rejected rows, in place of the report; scanImport reads both.
+const importSummaryColumns = `id, file_name, checksum, uploader, mode, state, rows_accepted, rows_written,
+  result, report_summary, error, created_at, started_at, finished_at, owner, heartbeat_at`
+
+func (r *sqlRepository) CreateImport(job models.ImportJob) error {
+	args, err := importArgs(job)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(r.rebind(`
+      INSERT INTO imports (`+importColumns+`, report_summary)
+      VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+    `), args...)
+	return err
+}
+
+func (r *sqlRepository) UpdateImport(job models.ImportJob) error {
+	args, err := importArgs(job)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.Exec(r.rebind(`
+      UPDATE imports
+      SET file_name = $2, checksum = $3, uploader = $4, mode = $5, state = $6, rows_accepted = $7,
+          rows_written = $8, result = $9, report = $10, error = $11, created_at = $12, started_at = $13,
+          finished_at = $14, owner = $15, heartbeat_at = $16, report_summary = $17
+      WHERE id = $1
+    `), args...)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sqlRepository) GetImport(id string) (*models.ImportJob, error) {
+	job, err := scanImport(r.db.QueryRow(r.rebind(`SELECT `+importColumns+` FROM imports WHERE id = $1`), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListImports reads the report summaries, leaving the full reports, which
+// may hold thousands of rejected rows, in the database.
+func (r *sqlRepository) ListImports(limit, offset int) ([]models.ImportJob, error) {
+	rows, err := r.db.Query(r.rebind(`
+      SELECT `+importSummaryColumns+`
+      FROM imports
+      ORDER BY created_at DESC, id DESC
+      LIMIT $1 OFFSET $2
+    `), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.ImportJob{}
+	for rows.Next() {
+		job, err := scanImport(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (r *sqlRepository) HeartbeatImport(id string, at time.Time) error {
+	_, err := r.db.Exec(r.rebind(`
+      UPDATE imports
+      SET heartbeat_at = $2
+      WHERE id = $1 AND state IN ($3, $4)
+    `), id, at.UTC(), models.ImportQueued, models.ImportRunning)
+	return err
+}
+
+func (r *sqlRepository) FailAbandonedImports(owner string, staleBefore time.Time, reason string, at time.Time) (int, error) {
+	res, err := r.db.Exec(r.rebind(`
+      UPDATE imports
+      SET state = $1, error = $2, finished_at = $3
+      WHERE state IN ($4, $5)
+        AND (COALESCE(heartbeat_at, created_at) < $6 OR (owner = $7 AND owner <> ''))
+    `), models.ImportFailed, reason, at.UTC(), models.ImportQueued, models.ImportRunning, staleBefore.UTC(), owner)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	return int(affected), err
+}
+
+// importArgs lists the columns of job in importColumns order, then the
+// report summary, with the result and reports as JSON.
+func importArgs(job models.ImportJob) ([]interface{}, error) {
+	result, err := jsonColumn(job.Result, job.Result == nil)
+	if err != nil {
+		return nil, err
+	}
+	report, err := jsonColumn(job.Report, job.Report == nil)
+	if err != nil {
+		return nil, err
+	}
+	var summary sql.NullString
+	if job.Report != nil {
+		if summary, err = jsonColumn(job.Report.Summary(), false); err != nil {
+			return nil, err
+		}
+	}
+	return []interface{}{
+		job.ID,
+		job.FileName,
+		job.Checksum,
+		job.Uploader,
+		job.Mode,
+		job.State,
+		job.Progress.RowsAccepted,
+		job.Progress.RowsWritten,
+		result,
+		report,
+		job.Error,
+		job.CreatedAt.UTC(),
+		nullTime(job.StartedAt),
+		nullTime(job.FinishedAt),
+		job.Owner,
+		nullTime(job.HeartbeatAt),
+		summary,
+	}, nil
+}
+
+func scanImport(row rowScanner) (models.ImportJob, error) {
+	var (
+		job                                models.ImportJob
+		result, report                     sql.NullString
+		startedAt, finishedAt, heartbeatAt sql.NullTime
+	)
+	err := row.Scan(
+		&job.ID,
+		&job.FileName,
+		&job.Checksum,
+		&job.Uploader,
+		&job.Mode,
+		&job.State,
+		&job.Progress.RowsAccepted,
+		&job.Progress.RowsWritten,
+		&result,
+		&report,
+		&job.Error,
+		&job.CreatedAt,
+		&startedAt,
+		&finishedAt,
+		&job.Owner,
+		&heartbeatAt,
+	)
+	if err != nil {
+		return job, err
+	}
+
+	if result.Valid {
+		job.Result = &models.ImportResult{}
+		if err := json.Unmarshal([]byte(result.String), job.Result); err != nil {
+			return job, err
+		}
+	}
+	if report.Valid {
+		job.Report = &models.ImportReport{}
+		if err := json.Unmarshal([]byte(report.String), job.Report); err != nil {
+			return job, err
+		}
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	if heartbeatAt.Valid {
+		job.HeartbeatAt = &heartbeatAt.Time
+	}
+	return job, nil
+}
+
+func jsonColumn(value interface{}, null bool) (sql.NullString, error) {
+	if null {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(value)
+	return sql.NullString{String: string(data), Valid: true}, err
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
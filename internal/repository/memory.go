@@ -0,0 +1,550 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/fuzzy"
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+)
+
+// MemoryRepository keeps SWIFT codes in a map. It mirrors the behaviour of
+// PostgresRepository and is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu     sync.RWMutex
+	nextID int64
+	codes  map[string]models.SwiftCodeData
+	// trigrams maps the trigrams of the search texts to their codes, for
+	// FuzzySearch.
+	trigrams map[string]map[string]struct{}
+	// imports holds the import jobs, created on first use.
+	imports map[string]models.ImportJob
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		codes:    make(map[string]models.SwiftCodeData),
+		trigrams: make(map[string]map[string]struct{}),
+	}
+}
+
+func (r *MemoryRepository) SaveSwiftCodes(data []models.SwiftCodeData) error {
+	_, err := r.ImportSwiftCodes(data, models.ImportInsert)
+	return err
+}
+
+func (r *MemoryRepository) ImportSwiftCodes(data []models.SwiftCodeData, mode models.ImportMode) (models.ImportResult, error) {
+	session, _ := r.BeginImport(mode)
+	session.Write(data)
+	return session.Commit()
+}
+
+// memoryImport collects the batches and applies them at once on Commit,
+// so readers never see a partial import.
+type memoryImport struct {
+	repo    *MemoryRepository
+	mode    models.ImportMode
+	pending []models.SwiftCodeData
+	// firstRows maps the written codes to their SourceRow.
+	firstRows map[string]int
+	done      bool
+}
+
+func (r *MemoryRepository) BeginImport(mode models.ImportMode) (ImportSession, error) {
+	return &memoryImport{repo: r, mode: mode, firstRows: make(map[string]int)}, nil
+}
+
+func (s *memoryImport) Write(batch []models.SwiftCodeData) ([]Duplicate, error) {
+	var duplicates []Duplicate
+	for i, sc := range batch {
+		if first, ok := s.firstRows[sc.SwiftCode]; ok {
+			duplicates = append(duplicates, Duplicate{Index: i, FirstRow: first})
+			continue
+		}
+		s.firstRows[sc.SwiftCode] = sc.SourceRow
+		s.pending = append(s.pending, sc)
+	}
+	return duplicates, nil
+}
+
+func (s *memoryImport) Commit() (models.ImportResult, error) {
+	if s.done {
+		return models.ImportResult{}, errors.New("import session already finished")
+	}
+	s.done = true
+
+	s.repo.mu.Lock()
+	defer s.repo.mu.Unlock()
+	return s.repo.importLocked(s.pending, s.firstRows, s.mode), nil
+}
+
+func (s *memoryImport) Rollback() error {
+	s.done = true
+	s.pending = nil
+	s.firstRows = nil
+	return nil
+}
+
+// importLocked applies an import of data, whose codes are the keys of
+// written; the caller holds the write lock.
+func (r *MemoryRepository) importLocked(data []models.SwiftCodeData, written map[string]int, mode models.ImportMode) models.ImportResult {
+	var result models.ImportResult
+	if mode == models.ImportReplace {
+		result.Deleted = len(r.codes)
+		r.codes = make(map[string]models.SwiftCodeData)
+		r.trigrams = make(map[string]map[string]struct{})
+	}
+
+	for _, sc := range data {
+		if sc.ImportID == "" {
+			sc.SourceRow = 0
+		}
+
+		existing, exists := r.codes[sc.SwiftCode]
+		switch {
+		case !exists:
+			r.nextID++
+			sc.ID = r.nextID
+			sc.Version = 1
+			r.codes[sc.SwiftCode] = sc
+			r.index(sc)
+			result.Inserted++
+		case existing.SameData(sc):
+			result.Unchanged++
+		case mode == models.ImportInsert:
+			result.Skipped++
+		default:
+			sc.ID = existing.ID
+			sc.Version = existing.Version + 1
+			r.reindex(existing, sc)
+			r.codes[sc.SwiftCode] = sc
+			result.Updated++
+		}
+	}
+
+	if mode == models.ImportSync {
+		for code, sc := range r.codes {
+			if _, ok := written[code]; !ok {
+				r.unindex(sc)
+				delete(r.codes, code)
+				result.Deleted++
+			}
+		}
+	}
+	return result
+}
+
+func (r *MemoryRepository) GetSwiftCode(swiftCode string) (*models.SwiftCodeData, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sc, ok := r.codes[swiftCode]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &sc, nil
+}
+
+func (r *MemoryRepository) GetSwiftCodes(codes []string) ([]models.SwiftCodeData, error) {
+	wanted := make(map[string]struct{}, len(codes))
+	for _, code := range codes {
+		wanted[code] = struct{}{}
+	}
+	return r.filter(func(sc models.SwiftCodeData) bool {
+		_, ok := wanted[sc.SwiftCode]
+		return ok
+	}), nil
+}
+
+func (r *MemoryRepository) ListCodes() ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	codes := make([]string, 0, len(r.codes))
+	for code := range r.codes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes, nil
+}
+
+func (r *MemoryRepository) GetSwiftCodesByBIC8(bic8s []string) ([]models.SwiftCodeData, error) {
+	wanted := make(map[string]struct{}, len(bic8s))
+	for _, bic8 := range bic8s {
+		wanted[bic8] = struct{}{}
+	}
+	return r.filter(func(sc models.SwiftCodeData) bool {
+		bic8 := sc.SwiftCode
+		if len(bic8) > 8 {
+			bic8 = bic8[:8]
+		}
+		_, ok := wanted[bic8]
+		return ok
+	}), nil
+}
+
+func (r *MemoryRepository) GetBranchesByHQ(swiftHQ string) ([]models.SwiftCodeData, error) {
+	base := swiftHQ[0:8]
+	return r.filter(func(sc models.SwiftCodeData) bool {
+		return len(sc.SwiftCode) >= 8 && sc.SwiftCode[0:8] == base && sc.SwiftCode != swiftHQ
+	}), nil
+}
+
+func (r *MemoryRepository) SearchSwiftCodes(q SearchQuery) ([]models.SwiftCodeData, int, error) {
+	for _, key := range q.Sort {
+		if !IsSortField(key.Field) {
+			return nil, 0, fmt.Errorf("cannot sort by %q", key.Field)
+		}
+	}
+	matched := r.filter(q.Matches)
+	sort.SliceStable(matched, func(i, j int) bool {
+		for _, key := range q.Sort {
+			if c := compareField(matched[i], matched[j], key.Field); c != 0 {
+				return (c < 0) != key.Desc
+			}
+		}
+		return matched[i].SwiftCode < matched[j].SwiftCode
+	})
+
+	total := len(matched)
+	if q.Offset > total {
+		q.Offset = total
+	}
+	end := total
+	if q.Limit < end-q.Offset {
+		end = q.Offset + q.Limit
+	}
+	return matched[q.Offset:end], total, nil
+}
+
+// compareField compares a field of two records, named as in JSON, like the
+// SQL repository orders them.
+func compareField(a, b models.SwiftCodeData, field string) int {
+	switch field {
+	case "isHeadquarter":
+		return compareBool(a.IsHeadquarter, b.IsHeadquarter)
+	case "sourceRow":
+		return a.SourceRow - b.SourceRow
+	}
+	return strings.Compare(stringField(a, field), stringField(b, field))
+}
+
+func stringField(sc models.SwiftCodeData, field string) string {
+	switch field {
+	case "swiftCode":
+		return sc.SwiftCode
+	case "bankName":
+		return sc.BankName
+	case "address":
+		return sc.Address
+	case "town":
+		return sc.Town
+	case "postalCode":
+		return sc.PostalCode
+	case "countryISO2":
+		return sc.CountryISO2
+	case "countryName":
+		return sc.CountryName
+	case "codeType":
+		return sc.CodeType
+	case "timeZone":
+		return sc.TimeZone
+	case "importId":
+		return sc.ImportID
+	}
+	return ""
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// FuzzySearch ranks the records sharing enough trigrams with q.Text to
+// reach q.MinScore, found through r.trigrams.
+func (r *MemoryRepository) FuzzySearch(q FuzzyQuery) ([]models.ScoredSwiftCode, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	trigrams := fuzzy.Trigrams(q.Text)
+	minShared := fuzzy.MinShared(len(trigrams), q.MinScore)
+	shared := make(map[string]int)
+	for _, trigram := range trigrams {
+		for code := range r.trigrams[trigram] {
+			shared[code]++
+		}
+	}
+	candidates := []models.SwiftCodeData{}
+	for code, n := range shared {
+		if n >= minShared {
+			candidates = append(candidates, r.codes[code])
+		}
+	}
+	return rankFuzzy(candidates, q), nil
+}
+
+// index adds sc to r.trigrams; the caller holds the write lock.
+func (r *MemoryRepository) index(sc models.SwiftCodeData) {
+	for _, trigram := range fuzzy.Trigrams(searchText(sc)) {
+		codes, ok := r.trigrams[trigram]
+		if !ok {
+			codes = make(map[string]struct{})
+			r.trigrams[trigram] = codes
+		}
+		codes[sc.SwiftCode] = struct{}{}
+	}
+}
+
+// unindex removes sc from r.trigrams; the caller holds the write lock.
+func (r *MemoryRepository) unindex(sc models.SwiftCodeData) {
+	for _, trigram := range fuzzy.Trigrams(searchText(sc)) {
+		delete(r.trigrams[trigram], sc.SwiftCode)
+		if len(r.trigrams[trigram]) == 0 {
+			delete(r.trigrams, trigram)
+		}
+	}
+}
+
+// reindex replaces old by sc in r.trigrams when the search text changed.
+func (r *MemoryRepository) reindex(old, sc models.SwiftCodeData) {
+	if searchText(old) != searchText(sc) {
+		r.unindex(old)
+		r.index(sc)
+	}
+}
+
+func (r *MemoryRepository) GetSwiftByCountryISO2(iso2 string, filter CountryFilter, page CountryPage) ([]models.SwiftCodeData, error) {
+	return r.countryPage(iso2, filter, page, false), nil
+}
+
+func (r *MemoryRepository) GetCountryHeadquarters(iso2 string, filter CountryFilter, page CountryPage) ([]models.Headquarter, error) {
+	headquarters := []models.Headquarter{}
+	for _, sc := range r.countryPage(iso2, filter, page, true) {
+		branches, err := r.GetBranchesByHQ(sc.SwiftCode)
+		if err != nil {
+			return nil, err
+		}
+		headquarters = append(headquarters, models.Headquarter{SwiftCodeData: sc, BranchCount: len(branches)})
+	}
+	return headquarters, nil
+}
+
+func (r *MemoryRepository) countryPage(iso2 string, filter CountryFilter, page CountryPage, headquarters bool) []models.SwiftCodeData {
+	matched := r.filter(func(sc models.SwiftCodeData) bool {
+		return sc.CountryISO2 == iso2 && filter.Matches(sc) && sc.SwiftCode > page.After &&
+			(!headquarters || sc.IsHeadquarter)
+	})
+	sort.Slice(matched, func(i, j int) bool { return matched[i].SwiftCode < matched[j].SwiftCode })
+	if page.Limit > 0 && len(matched) > page.Limit {
+		matched = matched[:page.Limit]
+	}
+	return matched
+}
+
+func (r *MemoryRepository) CountCountries() ([]models.CountrySummary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	byISO2 := make(map[string]*models.CountrySummary)
+	for _, sc := range r.codes {
+		s, ok := byISO2[sc.CountryISO2]
+		if !ok {
+			s = &models.CountrySummary{CountryISO2: sc.CountryISO2}
+			byISO2[sc.CountryISO2] = s
+		}
+		if sc.CountryName > s.CountryName {
+			s.CountryName = sc.CountryName
+		}
+		if sc.IsHeadquarter {
+			s.Headquarters++
+		} else {
+			s.Branches++
+		}
+	}
+
+	summaries := make([]models.CountrySummary, 0, len(byISO2))
+	for _, s := range byISO2 {
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].CountryISO2 < summaries[j].CountryISO2 })
+	return summaries, nil
+}
+
+func (r *MemoryRepository) HeadquarterMismatches() ([]models.SwiftCodeData, error) {
+	mismatches := r.filter(func(sc models.SwiftCodeData) bool {
+		return sc.IsHeadquarter != models.IsHeadquarterCode(sc.SwiftCode)
+	})
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].SwiftCode < mismatches[j].SwiftCode })
+	return mismatches, nil
+}
+
+func (r *MemoryRepository) RepairHeadquarters() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fixed := 0
+	for code, sc := range r.codes {
+		if isHQ := models.IsHeadquarterCode(code); sc.IsHeadquarter != isHQ {
+			sc.IsHeadquarter = isHQ
+			sc.Version++
+			r.codes[code] = sc
+			fixed++
+		}
+	}
+	return fixed, nil
+}
+
+func (r *MemoryRepository) UpdateSwiftCode(sc models.SwiftCodeData, expectedVersion int64) (*models.SwiftCodeData, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.codes[sc.SwiftCode]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if expectedVersion != 0 && current.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+	sc.ID = current.ID
+	sc.Version = current.Version + 1
+	sc.ImportID, sc.SourceRow = "", 0
+	r.reindex(current, sc)
+	r.codes[sc.SwiftCode] = sc
+	return &sc, nil
+}
+
+func (r *MemoryRepository) DeleteSwiftCode(swiftCode, bankName, iso2 string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sc, ok := r.codes[swiftCode]
+	if !ok || sc.BankName != bankName || sc.CountryISO2 != iso2 {
+		return ErrNotFound
+	}
+	r.unindex(sc)
+	delete(r.codes, swiftCode)
+	return nil
+}
+
+// filter returns the matching records ordered by id, i.e. insertion order.
+func (r *MemoryRepository) filter(match func(models.SwiftCodeData) bool) []models.SwiftCodeData {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []models.SwiftCodeData{}
+	for _, sc := range r.codes {
+		if match(sc) {
+			result = append(result, sc)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+func (r *MemoryRepository) CreateImport(job models.ImportJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.imports == nil {
+		r.imports = make(map[string]models.ImportJob)
+	}
+	if _, exists := r.imports[job.ID]; exists {
+		return fmt.Errorf("import %s already exists", job.ID)
+	}
+	r.imports[job.ID] = job
+	return nil
+}
+
+func (r *MemoryRepository) UpdateImport(job models.ImportJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.imports[job.ID]; !ok {
+		return ErrNotFound
+	}
+	r.imports[job.ID] = job
+	return nil
+}
+
+func (r *MemoryRepository) GetImport(id string) (*models.ImportJob, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	job, ok := r.imports[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &job, nil
+}
+
+func (r *MemoryRepository) ListImports(limit, offset int) ([]models.ImportJob, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	jobs := make([]models.ImportJob, 0, len(r.imports))
+	for _, job := range r.imports {
+		if job.Report != nil {
+			job.Report = job.Report.Summary()
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+		}
+		return jobs[i].ID > jobs[j].ID
+	})
+
+	if offset > len(jobs) {
+		offset = len(jobs)
+	}
+	jobs = jobs[offset:]
+	if limit < len(jobs) {
+		jobs = jobs[:limit]
+	}
+	return jobs, nil
+}
+
+func (r *MemoryRepository) HeartbeatImport(id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, ok := r.imports[id]; ok && !job.State.Finished() {
+		job.HeartbeatAt = &at
+		r.imports[id] = job
+	}
+	return nil
+}
+
+func (r *MemoryRepository) FailAbandonedImports(owner string, staleBefore time.Time, reason string, at time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	failed := 0
+	for id, job := range r.imports {
+		lastSeen := job.CreatedAt
+		if job.HeartbeatAt != nil {
+			lastSeen = *job.HeartbeatAt
+		}
+		abandoned := lastSeen.Before(staleBefore) || owner != "" && job.Owner == owner
+		if job.State.Finished() || !abandoned {
+			continue
+		}
+		job.State = models.ImportFailed
+		job.Error = reason
+		job.FinishedAt = &at
+		r.imports[id] = job
+		failed++
+	}
+	return failed, nil
+}
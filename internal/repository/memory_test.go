@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests that saving an existing code keeps the stored record, like ON CONFLICT DO NOTHING.
+func TestMemoryRepository_SaveKeepsExisting(t *testing.T) {
+	repo := NewMemoryRepository()
+
+	err := repo.SaveSwiftCodes([]models.SwiftCodeData{{SwiftCode: "TESTPLW1XXX", BankName: "FIRST"}})
+	assert.NoError(t, err)
+	err = repo.SaveSwiftCodes([]models.SwiftCodeData{{SwiftCode: "TESTPLW1XXX", BankName: "SECOND"}})
+	assert.NoError(t, err)
+
+	sc, err := repo.GetSwiftCode("TESTPLW1XXX")
+	assert.NoError(t, err)
+	assert.Equal(t, "FIRST", sc.BankName, "Existing record should not be overwritten")
+	assert.Equal(t, int64(1), sc.ID)
+}
+
+// Tests branch lookup by the 8-character prefix and listing by country.
+func TestMemoryRepository_BranchesAndCountry(t *testing.T) {
+	repo := NewMemoryRepository()
+	err := repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1XXX", CountryISO2: "PL", IsHeadquarter: true},
+		{SwiftCode: "TESTPLW1ABC", CountryISO2: "PL"},
+		{SwiftCode: "TESTPLW2ABC", CountryISO2: "PL"},
+		{SwiftCode: "TESTDEFFXXX", CountryISO2: "DE", IsHeadquarter: true},
+	})
+	assert.NoError(t, err)
+
+	branches, err := repo.GetBranchesByHQ("TESTPLW1XXX")
+	assert.NoError(t, err)
+	assert.Len(t, branches, 1)
+	assert.Equal(t, "TESTPLW1ABC", branches[0].SwiftCode)
+
+	pl, err := repo.GetSwiftByCountryISO2("PL", CountryFilter{}, CountryPage{})
+	assert.NoError(t, err)
+	assert.Len(t, pl, 3)
+
+	none, err := repo.GetSwiftByCountryISO2("US", CountryFilter{}, CountryPage{})
+	assert.NoError(t, err)
+	assert.Empty(t, none)
+}
@@ -0,0 +1,26 @@
+package repository
+
+import "database/sql"
+
+// PostgresRepository stores SWIFT codes in the swift_codes table of a PostgreSQL database.
+type PostgresRepository struct {
+	*sqlRepository
+}
+
+// Imports, including SaveSwiftCodes, are loaded with COPY through a staging table.
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	r := &sqlRepository{db: db, rebind: func(query string) string { return query }}
+	r.beginImport = r.beginCopyImport
+	return &PostgresRepository{r}
+}
+
+// RepairHeadquarters also validates swift_codes_headquarter_check, which is
+// added NOT VALID, once no stored row breaks it any more.
+func (r *PostgresRepository) RepairHeadquarters() (int, error) {
+	fixed, err := r.sqlRepository.RepairHeadquarters()
+	if err != nil {
+		return fixed, err
+	}
+	_, err = r.db.Exec(`ALTER TABLE swift_codes VALIDATE CONSTRAINT swift_codes_headquarter_check`)
+	return fixed, err
+}
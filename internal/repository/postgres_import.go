@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/lib/pq"
+)
+
+// copyImport is the PostgreSQL ImportSession: batches are streamed with COPY
+// into a temporary staging table and merged into swift_codes by a few
+// set-based statements on Commit, instead of one round trip per record.
+type copyImport struct {
+	tx     *sql.Tx
+	mode   models.ImportMode
+	result models.ImportResult
+	// staged is the number of records copied so far, the last seq.
+	staged int
+}
+
+// stagingColumns are the swift_codes columns filled by an import, in COPY order.
+var stagingColumns = []string{"swift_code", "bank_name", "address", "country_iso2", "country_name", "is_headquarter",
+	"code_type", "time_zone", "town", "postal_code", "import_id", "source_row"}
+
+// writtenColumns are the staging columns an import writes: stagingColumns and
+// file_row, the SourceRow of the record even without an import ID, which
+// duplicates are reported with.
+var writtenColumns = append(append([]string(nil), stagingColumns...), "file_row")
+
+// seq keeps the write order, which tells the first record of a code from
+// its duplicates.
+const createStaging = `
+  CREATE TEMP TABLE swift_codes_staging (
+    seq BIGSERIAL PRIMARY KEY,
+    swift_code TEXT NOT NULL,
+    bank_name TEXT NOT NULL,
+    address TEXT NOT NULL,
+    country_iso2 TEXT NOT NULL,
+    country_name TEXT NOT NULL,
+    is_headquarter BOOLEAN NOT NULL,
+    code_type TEXT NOT NULL,
+    time_zone TEXT NOT NULL,
+    town TEXT NOT NULL,
+    postal_code TEXT NOT NULL,
+    import_id TEXT,
+    source_row INTEGER,
+    file_row INTEGER NOT NULL
+  ) ON COMMIT DROP
+`
+
+// sameData matches a stored row c with its staged row s, like SwiftCodeData.SameData.
+const sameData = `(c.bank_name, c.address, c.town, c.postal_code, c.country_iso2, c.country_name, c.is_headquarter,
+      c.code_type, c.time_zone)
+    = (s.bank_name, s.address, s.town, s.postal_code, s.country_iso2, s.country_name, s.is_headquarter,
+      s.code_type, s.time_zone)`
+
+func (r *sqlRepository) beginCopyImport(mode models.ImportMode) (ImportSession, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	s := &copyImport{tx: tx, mode: mode}
+
+	if _, err := tx.Exec(createStaging); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if _, err := tx.Exec(`CREATE INDEX ON swift_codes_staging (swift_code)`); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if mode == models.ImportReplace {
+		deleted, err := s.exec(`DELETE FROM swift_codes`)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		s.result.Deleted = deleted
+	}
+	return s, nil
+}
+
+func (s *copyImport) Write(batch []models.SwiftCodeData) ([]Duplicate, error) {
+	stmt, err := s.tx.Prepare(pq.CopyIn("swift_codes_staging", writtenColumns...))
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	for _, sc := range batch {
+		importID, sourceRow := provenanceArgs(sc)
+		if _, err := stmt.Exec(sc.SwiftCode, sc.BankName, sc.Address, sc.CountryISO2, sc.CountryName, sc.IsHeadquarter,
+			sc.CodeType, sc.TimeZone, sc.Town, sc.PostalCode, importID, sourceRow, sc.SourceRow); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		return nil, err
+	}
+	if err := stmt.Close(); err != nil {
+		return nil, err
+	}
+
+	// Remove the records of the batch whose code was staged before, by an
+	// earlier batch or earlier in this one, and report the first row of it.
+	rows, err := s.tx.Query(`
+      DELETE FROM swift_codes_staging s
+      USING swift_codes_staging f
+      WHERE s.seq > $1 AND f.swift_code = s.swift_code
+        AND f.seq = (SELECT min(m.seq) FROM swift_codes_staging m WHERE m.swift_code = s.swift_code)
+        AND f.seq < s.seq
+      RETURNING s.seq, f.file_row
+    `, s.staged)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var duplicates []Duplicate
+	for rows.Next() {
+		var seq int
+		var duplicate Duplicate
+		if err := rows.Scan(&seq, &duplicate.FirstRow); err != nil {
+			return nil, err
+		}
+		duplicate.Index = seq - s.staged - 1
+		duplicates = append(duplicates, duplicate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.staged += len(batch)
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i].Index < duplicates[j].Index })
+	return duplicates, nil
+}
+
+func (s *copyImport) Commit() (models.ImportResult, error) {
+	if err := s.merge(); err != nil {
+		return s.result, err
+	}
+	return s.result, s.tx.Commit()
+}
+
+func (s *copyImport) merge() error {
+	if _, err := s.tx.Exec(`ANALYZE swift_codes_staging`); err != nil {
+		return err
+	}
+
+	var changed int
+	err := s.tx.QueryRow(`
+      SELECT count(*) FILTER (WHERE `+sameData+`),
+             count(*) FILTER (WHERE NOT `+sameData+`)
+      FROM swift_codes_staging s
+      JOIN swift_codes c ON c.swift_code = s.swift_code
+    `).Scan(&s.result.Unchanged, &changed)
+	if err != nil {
+		return err
+	}
+
+	if s.mode == models.ImportInsert {
+		s.result.Skipped = changed
+	} else {
+		s.result.Updated, err = s.exec(`
+          UPDATE swift_codes c
+          SET bank_name = s.bank_name, address = s.address, country_iso2 = s.country_iso2,
+              country_name = s.country_name, is_headquarter = s.is_headquarter,
+              code_type = s.code_type, time_zone = s.time_zone, town = s.town, postal_code = s.postal_code,
+              import_id = s.import_id, source_row = s.source_row, version = c.version + 1
+          FROM swift_codes_staging s
+          WHERE c.swift_code = s.swift_code AND NOT ` + sameData)
+		if err != nil {
+			return err
+		}
+	}
+
+	inserted, err := s.exec(`
+      INSERT INTO swift_codes (swift_code, bank_name, address, country_iso2, country_name, is_headquarter,
+                               code_type, time_zone, town, postal_code, import_id, source_row)
+      SELECT s.swift_code, s.bank_name, s.address, s.country_iso2, s.country_name, s.is_headquarter,
+             s.code_type, s.time_zone, s.town, s.postal_code, s.import_id, s.source_row
+      FROM swift_codes_staging s
+      WHERE NOT EXISTS (SELECT 1 FROM swift_codes c WHERE c.swift_code = s.swift_code)
+      ORDER BY s.seq
+    `)
+	if err != nil {
+		return err
+	}
+	s.result.Inserted = inserted
+
+	if s.mode == models.ImportSync {
+		deleted, err := s.exec(`
+          DELETE FROM swift_codes c
+          WHERE NOT EXISTS (SELECT 1 FROM swift_codes_staging s WHERE s.swift_code = c.swift_code)
+        `)
+		if err != nil {
+			return err
+		}
+		s.result.Deleted = deleted
+	}
+	return nil
+}
+
+func (s *copyImport) Rollback() error {
+	err := s.tx.Rollback()
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
+
+// exec runs a statement in the import transaction and returns the affected rows.
+func (s *copyImport) exec(query string) (int, error) {
+	res, err := s.tx.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	return int(affected), err
+}
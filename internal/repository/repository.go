@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when no stored record matches the lookup.
+	ErrNotFound = errors.New("no matching record found")
+	// ErrVersionConflict is returned when a record changed since the version the caller read.
+	ErrVersionConflict = errors.New("record was modified by someone else")
+)
+
+// SwiftCodeRepository is the storage used by the services layer.
+// Implementations must be safe for concurrent use.
+type SwiftCodeRepository interface {
+	ImportJobRepository
+
+	// SaveSwiftCodes inserts the records, leaving already stored codes untouched.
+	SaveSwiftCodes(data []models.SwiftCodeData) error
+	// ImportSwiftCodes stores the records according to mode in a single transaction.
+	ImportSwiftCodes(data []models.SwiftCodeData, mode models.ImportMode) (models.ImportResult, error)
+	// BeginImport starts an import whose records arrive in batches. Nothing
+	// is visible to readers until the session is committed.
+	BeginImport(mode models.ImportMode) (ImportSession, error)
+	// GetSwiftCode returns the record with the given code or ErrNotFound.
+	GetSwiftCode(swiftCode string) (*models.SwiftCodeData, error)
+	// GetSwiftCodes returns the stored records among codes; unknown codes are left out.
+	GetSwiftCodes(codes []string) ([]models.SwiftCodeData, error)
+	// GetSwiftCodesByBIC8 returns, in insertion order, every stored record
+	// whose first 8 characters are one of bic8s; shorter entries match a
+	// whole code.
+	GetSwiftCodesByBIC8(bic8s []string) ([]models.SwiftCodeData, error)
+	// ListCodes returns every stored SWIFT code.
+	ListCodes() ([]string, error)
+	// GetBranchesByHQ returns every record sharing the first 8 characters
+	// of swiftHQ, except the headquarter itself.
+	GetBranchesByHQ(swiftHQ string) ([]models.SwiftCodeData, error)
+	// SearchSwiftCodes returns the page of records matching q, in its order,
+	// and how many records match in total.
+	SearchSwiftCodes(q SearchQuery) ([]models.SwiftCodeData, int, error)
+	// FuzzySearch ranks the records whose bank name and address match q.Text,
+	// ignoring case and diacritics, best first and then by SWIFT code.
+	FuzzySearch(q FuzzyQuery) ([]models.ScoredSwiftCode, error)
+	// GetSwiftByCountryISO2 returns the page of records of a country matching
+	// filter, ordered by SWIFT code.
+	GetSwiftByCountryISO2(iso2 string, filter CountryFilter, page CountryPage) ([]models.SwiftCodeData, error)
+	// GetCountryHeadquarters is GetSwiftByCountryISO2 for headquarters only,
+	// each with its number of branches, which are not filtered.
+	GetCountryHeadquarters(iso2 string, filter CountryFilter, page CountryPage) ([]models.Headquarter, error)
+	// CountCountries returns, for every country with stored codes, ordered by
+	// ISO2, its number of headquarters and branches and one of its stored names.
+	CountCountries() ([]models.CountrySummary, error)
+	// HeadquarterMismatches returns, ordered by code, the records whose
+	// isHeadquarter flag contradicts their code (see models.IsHeadquarterCode),
+	// stored before the rule was enforced.
+	HeadquarterMismatches() ([]models.SwiftCodeData, error)
+	// RepairHeadquarters sets the isHeadquarter flag of those records from
+	// their code, bumping their version, and returns how many were changed.
+	RepairHeadquarters() (int, error)
+	// UpdateSwiftCode overwrites the record with sc.SwiftCode and bumps its version.
+	// A non-zero expectedVersion must match the stored one, otherwise
+	// ErrVersionConflict is returned.
+	UpdateSwiftCode(sc models.SwiftCodeData, expectedVersion int64) (*models.SwiftCodeData, error)
+	// DeleteSwiftCode removes the record matching all three values or returns ErrNotFound.
+	DeleteSwiftCode(swiftCode, bankName, iso2 string) error
+}
+
+// CountryFilter narrows the records of a country; empty fields match every record.
+type CountryFilter struct {
+	CodeType string
+	TimeZone string
+	// Town is compared with the stored, upper-cased town.
+	Town string
+}
+
+// Matches reports whether sc passes the filter.
+func (f CountryFilter) Matches(sc models.SwiftCodeData) bool {
+	return (f.CodeType == "" || sc.CodeType == f.CodeType) &&
+		(f.TimeZone == "" || sc.TimeZone == f.TimeZone) &&
+		(f.Town == "" || sc.Town == f.Town)
+}
+
+// CountryPage selects a page of a country's records, ordered by SWIFT code.
+type CountryPage struct {
+	// After is the last code of the previous page, empty for the first page.
+	After string
+	// Limit is the most records returned, 0 for all of them.
+	Limit int
+}
+
+// SearchQuery selects, orders and pages stored records. Empty fields match
+// every record.
+type SearchQuery struct {
+	// BankName is contained in the bank name, ignoring case.
+	BankName string
+	// Town is compared with the stored, upper-cased town.
+	Town      string
+	Countries []string
+	// IsHeadquarter, when set, keeps only headquarters or only branches.
+	IsHeadquarter *bool
+	// CodePrefix is the start of the normalized SWIFT code.
+	CodePrefix string
+	CodeType   string
+	// Sort orders the records, ties being broken by SWIFT code.
+	Sort   []SortKey
+	Limit  int
+	Offset int
+}
+
+// FuzzyQuery is a ranked search by bank name and address.
+type FuzzyQuery struct {
+	Text string
+	// Countries, when not empty, keeps only records of these countries.
+	Countries []string
+	// MinScore is the lowest relevance returned, from 0 to 1.
+	MinScore float64
+	Limit    int
+}
+
+// SortKey orders search results by one field, named as in the JSON representation.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// sortColumns maps the fields results can be sorted by to their column.
+// Provenance is compared as empty when a record has none, as in JSON.
+var sortColumns = map[string]string{
+	"swiftCode":     "swift_code",
+	"bankName":      "bank_name",
+	"address":       "address",
+	"town":          "town",
+	"postalCode":    "postal_code",
+	"countryISO2":   "country_iso2",
+	"countryName":   "country_name",
+	"isHeadquarter": "is_headquarter",
+	"codeType":      "code_type",
+	"timeZone":      "time_zone",
+	"importId":      "COALESCE(import_id, '')",
+	"sourceRow":     "COALESCE(source_row, 0)",
+}
+
+// IsSortField reports whether search results can be sorted by field.
+func IsSortField(field string) bool {
+	_, ok := sortColumns[field]
+	return ok
+}
+
+// Matches reports whether sc passes the filters of q.
+func (q SearchQuery) Matches(sc models.SwiftCodeData) bool {
+	if q.BankName != "" && !strings.Contains(strings.ToUpper(sc.BankName), strings.ToUpper(q.BankName)) {
+		return false
+	}
+	if len(q.Countries) > 0 && !containsString(q.Countries, sc.CountryISO2) {
+		return false
+	}
+	return (q.Town == "" || sc.Town == q.Town) &&
+		(q.IsHeadquarter == nil || sc.IsHeadquarter == *q.IsHeadquarter) &&
+		strings.HasPrefix(sc.SwiftCode, q.CodePrefix) &&
+		(q.CodeType == "" || sc.CodeType == q.CodeType)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportJobRepository keeps the state of import jobs and, once they are
+// finished, the history of imports.
+type ImportJobRepository interface {
+	// CreateImport stores a new job.
+	CreateImport(job models.ImportJob) error
+	// UpdateImport overwrites the stored job with the same ID or returns ErrNotFound.
+	UpdateImport(job models.ImportJob) error
+	// GetImport returns the job with the given ID or ErrNotFound.
+	GetImport(id string) (*models.ImportJob, error)
+	// ListImports returns up to limit jobs, newest first, skipping offset,
+	// with only the Summary of their reports.
+	ListImports(limit, offset int) ([]models.ImportJob, error)
+	// HeartbeatImport records that the unfinished job with the given ID is
+	// still being run by its owner.
+	HeartbeatImport(id string, at time.Time) error
+	// FailAbandonedImports marks as failed with reason the queued or running
+	// jobs whose last heartbeat (or creation, without one) is before
+	// staleBefore, and, unless owner is empty, those of owner, e.g. after it
+	// restarted. It returns how many there were.
+	FailAbandonedImports(owner string, staleBefore time.Time, reason string, at time.Time) (int, error)
+}
+
+// Duplicate is a record an ImportSession skipped because its code was
+// written before in the same import.
+type Duplicate struct {
+	// Index is the position of the record in its batch.
+	Index int
+	// FirstRow is the SourceRow of the record written first.
+	FirstRow int
+}
+
+// ImportSession is an import in progress, see SwiftCodeRepository.BeginImport.
+// A session is used by one goroutine and must end with Commit or Rollback.
+type ImportSession interface {
+	// Write stores a batch of records according to the session's mode. The
+	// first record of a code wins: one already written in the session, by
+	// this batch or an earlier one, is skipped and returned as a Duplicate.
+	Write(batch []models.SwiftCodeData) ([]Duplicate, error)
+	// Commit finishes the import, in sync mode deleting the stored codes
+	// that were never written, and returns the counts.
+	Commit() (models.ImportResult, error)
+	// Rollback discards the import. It does nothing after Commit.
+	Rollback() error
+}
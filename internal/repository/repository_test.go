@@ -0,0 +1,638 @@
+package repository
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/database"
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// repositories returns every implementation that can run without a server.
+func repositories(t *testing.T) map[string]SwiftCodeRepository {
+	db, err := database.ConnectAndMigrateSQLite(filepath.Join(t.TempDir(), "swift.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return map[string]SwiftCodeRepository{
+		"memory": NewMemoryRepository(),
+		"sqlite": NewSQLiteRepository(db),
+	}
+}
+
+func importFixture() []models.SwiftCodeData {
+	return []models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1XXX", BankName: "TEST BANK", Address: "HQ", CountryISO2: "PL", CountryName: "POLAND", IsHeadquarter: true},
+		{SwiftCode: "TESTPLW1ABC", BankName: "TEST BANK", Address: "BRANCH", CountryISO2: "PL", CountryName: "POLAND"},
+		{SwiftCode: "TESTDEFFXXX", BankName: "TEST BANK DE", Address: "HQ", CountryISO2: "DE", CountryName: "GERMANY", IsHeadquarter: true},
+	}
+}
+
+// corrected is the fixture after a correction: one changed row, one removed, one added.
+func corrected() []models.SwiftCodeData {
+	data := importFixture()[:2]
+	data[1].Address = "FIXED BRANCH"
+	return append(data, models.SwiftCodeData{
+		SwiftCode: "TESTATWWXXX", BankName: "TEST BANK AT", Address: "HQ", CountryISO2: "AT", CountryName: "AUSTRIA", IsHeadquarter: true,
+	})
+}
+
+// Tests the counts and stored state of every import mode on every repository.
+func TestImportModes(t *testing.T) {
+	cases := []struct {
+		mode     models.ImportMode
+		expected models.ImportResult
+		address  string
+		deKept   bool
+	}{
+		{models.ImportInsert, models.ImportResult{Inserted: 1, Unchanged: 1, Skipped: 1}, "BRANCH", true},
+		{models.ImportUpsert, models.ImportResult{Inserted: 1, Unchanged: 1, Updated: 1}, "FIXED BRANCH", true},
+		{models.ImportSync, models.ImportResult{Inserted: 1, Unchanged: 1, Updated: 1, Deleted: 1}, "FIXED BRANCH", false},
+		{models.ImportReplace, models.ImportResult{Inserted: 3, Deleted: 3}, "FIXED BRANCH", false},
+	}
+
+	for _, tc := range cases {
+		for name, repo := range repositories(t) {
+			t.Run(string(tc.mode)+"/"+name, func(t *testing.T) {
+				first, err := repo.ImportSwiftCodes(importFixture(), tc.mode)
+				require.NoError(t, err)
+				assert.Equal(t, 3, first.Inserted)
+
+				result, err := repo.ImportSwiftCodes(corrected(), tc.mode)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, result)
+
+				branch, err := repo.GetSwiftCode("TESTPLW1ABC")
+				require.NoError(t, err)
+				assert.Equal(t, tc.address, branch.Address)
+
+				_, err = repo.GetSwiftCode("TESTDEFFXXX")
+				if tc.deKept {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorIs(t, err, ErrNotFound)
+				}
+
+				_, err = repo.GetSwiftCode("TESTATWWXXX")
+				assert.NoError(t, err, "New codes are inserted in every mode")
+			})
+		}
+	}
+}
+
+// Tests that an upsert bumps the version of changed rows only.
+func TestImportUpsertVersions(t *testing.T) {
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := repo.ImportSwiftCodes(importFixture(), models.ImportUpsert)
+			require.NoError(t, err)
+			_, err = repo.ImportSwiftCodes(corrected(), models.ImportUpsert)
+			require.NoError(t, err)
+
+			hq, _ := repo.GetSwiftCode("TESTPLW1XXX")
+			branch, _ := repo.GetSwiftCode("TESTPLW1ABC")
+			assert.Equal(t, int64(1), hq.Version)
+			assert.Equal(t, int64(2), branch.Version)
+		})
+	}
+}
+
+// Tests that batch lookups span several IN-list chunks and skip unknown codes.
+func TestGetSwiftCodes(t *testing.T) {
+	var data []models.SwiftCodeData
+	var codes []string
+	for i := 0; i < 2*lookupChunkSize+10; i++ {
+		code := fmt.Sprintf("TESTPL%02d%03d", i/1000, i%1000)
+		data = append(data, models.SwiftCodeData{SwiftCode: code, BankName: "TEST BANK", CountryISO2: "PL", CountryName: "POLAND"})
+		codes = append(codes, code)
+	}
+	codes = append(codes, "NOPEPLW1XXX")
+
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, repo.SaveSwiftCodes(data))
+
+			found, err := repo.GetSwiftCodes(codes)
+			assert.NoError(t, err)
+			assert.Len(t, found, len(data))
+
+			all, err := repo.ListCodes()
+			assert.NoError(t, err)
+			assert.Len(t, all, len(data))
+			assert.Equal(t, data[0].SwiftCode, all[0], "Codes should be sorted")
+		})
+	}
+}
+
+// Tests that codes are selected by their first 8 characters, with as many
+// prefixes as a batch lookup may send, split over several IN-list chunks.
+func TestGetSwiftCodesByBIC8(t *testing.T) {
+	bic8s := []string{"TESTPLW1", "TESTDEFFXXX", "NOPEPLW1"}
+	for i := len(bic8s); i < 10000; i++ {
+		bic8s = append(bic8s, fmt.Sprintf("B%07d", i))
+	}
+	bic8s = append(bic8s, "TESTDEFF")
+
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, repo.SaveSwiftCodes(importFixture()))
+
+			found, err := repo.GetSwiftCodesByBIC8(bic8s)
+			require.NoError(t, err)
+			var codes []string
+			for _, sc := range found {
+				codes = append(codes, sc.SwiftCode)
+			}
+			assert.Equal(t, []string{"TESTPLW1XXX", "TESTPLW1ABC", "TESTDEFFXXX"}, codes, "Records should come in insertion order")
+
+			found, err = repo.GetSwiftCodesByBIC8(nil)
+			assert.NoError(t, err)
+			assert.Empty(t, found)
+		})
+	}
+}
+
+// Tests combined search filters, sorting, paging and the total count.
+func TestSearchSwiftCodes(t *testing.T) {
+	data := []models.SwiftCodeData{
+		{SwiftCode: "SPKADEFFXXX", BankName: "Sparkasse Koeln", CountryISO2: "DE", IsHeadquarter: true, Town: "KOELN", CodeType: "BIC11"},
+		{SwiftCode: "SPKADEFF100", BankName: "SPARKASSE KOELN", CountryISO2: "DE", Town: "BONN", CodeType: "BIC11"},
+		{SwiftCode: "SPARATWWXXX", BankName: "ERSTE SPARKASSE", CountryISO2: "AT", IsHeadquarter: true, Town: "WIEN"},
+		{SwiftCode: "SPARPLPWXXX", BankName: "SPARKASSE POLSKA", CountryISO2: "PL", IsHeadquarter: true},
+		{SwiftCode: "DEUTDEFFXXX", BankName: "DEUTSCHE BANK", CountryISO2: "DE", IsHeadquarter: true},
+		{SwiftCode: "TEST_DEFXXX", BankName: "100% BANK", CountryISO2: "DE", IsHeadquarter: true},
+	}
+	codes := func(page []models.SwiftCodeData) []string {
+		var result []string
+		for _, sc := range page {
+			result = append(result, sc.SwiftCode)
+		}
+		return result
+	}
+	hq := true
+
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, repo.SaveSwiftCodes(data))
+
+			page, total, err := repo.SearchSwiftCodes(SearchQuery{
+				BankName: "sparkasse", Countries: []string{"DE", "AT"}, IsHeadquarter: &hq, Limit: 10,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, 2, total)
+			assert.Equal(t, []string{"SPARATWWXXX", "SPKADEFFXXX"}, codes(page))
+
+			page, total, err = repo.SearchSwiftCodes(SearchQuery{
+				CodePrefix: "SPKADEFF", Sort: []SortKey{{Field: "town", Desc: true}}, Limit: 10,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, 2, total)
+			assert.Equal(t, []string{"SPKADEFFXXX", "SPKADEFF100"}, codes(page))
+
+			page, total, err = repo.SearchSwiftCodes(SearchQuery{
+				Sort: []SortKey{{Field: "countryISO2"}, {Field: "isHeadquarter", Desc: true}}, Limit: 2, Offset: 1,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, len(data), total)
+			assert.Equal(t, []string{"DEUTDEFFXXX", "SPKADEFFXXX"}, codes(page))
+
+			page, total, err = repo.SearchSwiftCodes(SearchQuery{BankName: "0%", CodePrefix: "TEST_", Limit: 10})
+			require.NoError(t, err)
+			assert.Equal(t, 1, total, "Wildcards in the input should match literally")
+			assert.Equal(t, []string{"TEST_DEFXXX"}, codes(page))
+
+			page, total, err = repo.SearchSwiftCodes(SearchQuery{Town: "BONN", CodeType: "BIC11", Limit: 10, Offset: 5})
+			require.NoError(t, err)
+			assert.Equal(t, 1, total)
+			assert.Empty(t, page)
+
+			_, _, err = repo.SearchSwiftCodes(SearchQuery{Sort: []SortKey{{Field: "version"}}, Limit: 10})
+			assert.Error(t, err)
+		})
+	}
+}
+
+// Tests that fuzzy search ranks by relevance, ignoring case and diacritics, within the score and country limits.
+func TestFuzzySearch(t *testing.T) {
+	data := []models.SwiftCodeData{
+		{SwiftCode: "PKOPPLPWXXX", BankName: "BANK POLSKA KASA OPIEKI SA", Address: "GRZYBOWSKA 53/57", CountryISO2: "PL", IsHeadquarter: true},
+		{SwiftCode: "PKOPPLPW123", BankName: "BANK POLSKA KASA OPIEKI SA", Address: "PIOTRKOWSKA 3 ŁÓDŹ", CountryISO2: "PL"},
+		{SwiftCode: "PKOBPLPWXXX", BankName: "POWSZECHNA KASA OSZCZEDNOSCI BANK POLSKI", CountryISO2: "PL", IsHeadquarter: true},
+		{SwiftCode: "DEUTDEFFXXX", BankName: "DEUTSCHE BANK", CountryISO2: "DE", IsHeadquarter: true},
+	}
+
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, repo.SaveSwiftCodes(data))
+
+			ranked, err := repo.FuzzySearch(FuzzyQuery{Text: "bank polska kasa opieki", MinScore: 0.3, Limit: 10})
+			require.NoError(t, err)
+			require.GreaterOrEqual(t, len(ranked), 3)
+			assert.Equal(t, "PKOPPLPW123", ranked[0].SwiftCode)
+			assert.Equal(t, "PKOPPLPWXXX", ranked[1].SwiftCode)
+			assert.Equal(t, 1.0, ranked[0].Score)
+			assert.Less(t, ranked[2].Score, ranked[1].Score)
+			for _, result := range ranked {
+				assert.NotEqual(t, "DEUTDEFFXXX", result.SwiftCode, "Unrelated banks should be left out")
+			}
+
+			ranked, err = repo.FuzzySearch(FuzzyQuery{Text: "lodz", MinScore: 0.9, Limit: 10})
+			require.NoError(t, err)
+			require.Len(t, ranked, 1)
+			assert.Equal(t, "PKOPPLPW123", ranked[0].SwiftCode)
+
+			ranked, err = repo.FuzzySearch(FuzzyQuery{Text: "bank", Countries: []string{"DE"}, MinScore: 0.3, Limit: 10})
+			require.NoError(t, err)
+			require.Len(t, ranked, 1)
+			assert.Equal(t, "DEUTDEFFXXX", ranked[0].SwiftCode)
+
+			ranked, err = repo.FuzzySearch(FuzzyQuery{Text: "bank", MinScore: 0.3, Limit: 2})
+			require.NoError(t, err)
+			assert.Len(t, ranked, 2)
+		})
+	}
+}
+
+// Tests that fuzzy search, which only ranks the codes found through its
+// index, sees updated, deleted and imported codes.
+func TestFuzzySearch_FollowsChanges(t *testing.T) {
+	found := func(t *testing.T, repo SwiftCodeRepository, text string) []string {
+		ranked, err := repo.FuzzySearch(FuzzyQuery{Text: text, MinScore: 0.5, Limit: 10})
+		require.NoError(t, err)
+		codes := []string{}
+		for _, result := range ranked {
+			codes = append(codes, result.SwiftCode)
+		}
+		return codes
+	}
+
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := repo.ImportSwiftCodes(importFixture(), models.ImportInsert)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"TESTPLW1ABC"}, found(t, repo, "branch"))
+
+			branch := importFixture()[1]
+			branch.Address = "KRAKOW"
+			_, err = repo.UpdateSwiftCode(branch, 0)
+			require.NoError(t, err)
+			assert.Empty(t, found(t, repo, "branch"))
+			assert.Equal(t, []string{"TESTPLW1ABC"}, found(t, repo, "krakow"))
+
+			require.NoError(t, repo.DeleteSwiftCode(branch.SwiftCode, branch.BankName, branch.CountryISO2))
+			assert.Empty(t, found(t, repo, "krakow"))
+
+			_, err = repo.ImportSwiftCodes(corrected(), models.ImportSync)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"TESTPLW1ABC"}, found(t, repo, "fixed branch"))
+			assert.Equal(t, "TESTATWWXXX", found(t, repo, "test bank at")[0])
+
+			_, err = repo.ImportSwiftCodes(importFixture()[2:], models.ImportReplace)
+			require.NoError(t, err)
+			assert.Empty(t, found(t, repo, "fixed branch"))
+			assert.Equal(t, []string{"TESTDEFFXXX"}, found(t, repo, "test bank"))
+		})
+	}
+}
+
+// Tests that a country's records are paged in code order and headquarters come with their branch counts.
+func TestCountryPages(t *testing.T) {
+	data := []models.SwiftCodeData{
+		{SwiftCode: "BBBBPLPWXXX", BankName: "B", CountryISO2: "PL", IsHeadquarter: true},
+		{SwiftCode: "AAAAPLPW123", BankName: "A", CountryISO2: "PL"},
+		{SwiftCode: "AAAAPLPWXXX", BankName: "A", CountryISO2: "PL", IsHeadquarter: true},
+		{SwiftCode: "AAAAPLPW456", BankName: "A", CountryISO2: "PL"},
+		{SwiftCode: "CCCCPLPW123", BankName: "C", CountryISO2: "PL"},
+	}
+	codes := func(page []models.SwiftCodeData) []string {
+		var result []string
+		for _, sc := range page {
+			result = append(result, sc.SwiftCode)
+		}
+		return result
+	}
+
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, repo.SaveSwiftCodes(data))
+
+			first, err := repo.GetSwiftByCountryISO2("PL", CountryFilter{}, CountryPage{Limit: 2})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"AAAAPLPW123", "AAAAPLPW456"}, codes(first))
+			rest, err := repo.GetSwiftByCountryISO2("PL", CountryFilter{}, CountryPage{After: "AAAAPLPW456"})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"AAAAPLPWXXX", "BBBBPLPWXXX", "CCCCPLPW123"}, codes(rest))
+
+			headquarters, err := repo.GetCountryHeadquarters("PL", CountryFilter{}, CountryPage{Limit: 10})
+			require.NoError(t, err)
+			require.Len(t, headquarters, 2)
+			assert.Equal(t, "AAAAPLPWXXX", headquarters[0].SwiftCode)
+			assert.Equal(t, 2, headquarters[0].BranchCount)
+			assert.Equal(t, "BBBBPLPWXXX", headquarters[1].SwiftCode)
+			assert.Equal(t, 0, headquarters[1].BranchCount)
+
+			headquarters, err = repo.GetCountryHeadquarters("PL", CountryFilter{}, CountryPage{After: "AAAAPLPWXXX", Limit: 10})
+			require.NoError(t, err)
+			require.Len(t, headquarters, 1)
+			assert.Equal(t, "BBBBPLPWXXX", headquarters[0].SwiftCode)
+		})
+	}
+}
+
+// Tests that an import written in several batches behaves like one call,
+// and that a rolled back session leaves the stored data untouched.
+func TestImportSession(t *testing.T) {
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := repo.ImportSwiftCodes(importFixture(), models.ImportInsert)
+			require.NoError(t, err)
+
+			session, err := repo.BeginImport(models.ImportReplace)
+			require.NoError(t, err)
+			_, err = session.Write(corrected()[:1])
+			require.NoError(t, err)
+			require.NoError(t, session.Rollback())
+
+			codes, err := repo.ListCodes()
+			require.NoError(t, err)
+			assert.Len(t, codes, 3, "A rolled back replace should keep the old data")
+
+			data := corrected()
+			session, err = repo.BeginImport(models.ImportSync)
+			require.NoError(t, err)
+			defer session.Rollback()
+			_, err = session.Write(data[:1])
+			require.NoError(t, err)
+			_, err = session.Write(data[1:])
+			require.NoError(t, err)
+			result, err := session.Commit()
+			require.NoError(t, err)
+			assert.Equal(t, models.ImportResult{Inserted: 1, Unchanged: 1, Updated: 1, Deleted: 1}, result)
+			assert.NoError(t, session.Rollback(), "Rollback after Commit should do nothing")
+
+			codes, err = repo.ListCodes()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"TESTATWWXXX", "TESTPLW1ABC", "TESTPLW1XXX"}, codes)
+		})
+	}
+}
+
+// Tests that a code written again in a session, by the same batch or a later
+// one, is skipped and returned with the row it was first written from.
+func TestImportSession_Duplicates(t *testing.T) {
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, repo.SaveSwiftCodes([]models.SwiftCodeData{
+				{SwiftCode: "OTHRPLPWXXX", BankName: "OTHER", CountryISO2: "PL", CountryName: "POLAND", IsHeadquarter: true},
+			}))
+
+			first := importFixture()
+			for i := range first {
+				first[i].SourceRow = i + 2
+			}
+			data := corrected()
+			again := []models.SwiftCodeData{data[2], data[0], data[1], data[2]}
+			for i := range again {
+				again[i].SourceRow = i + 5
+			}
+
+			session, err := repo.BeginImport(models.ImportSync)
+			require.NoError(t, err)
+			defer session.Rollback()
+			duplicates, err := session.Write(first)
+			require.NoError(t, err)
+			assert.Empty(t, duplicates)
+			duplicates, err = session.Write(again)
+			require.NoError(t, err)
+			assert.Equal(t, []Duplicate{{Index: 1, FirstRow: 2}, {Index: 2, FirstRow: 3}, {Index: 3, FirstRow: 5}}, duplicates)
+
+			result, err := session.Commit()
+			require.NoError(t, err)
+			assert.Equal(t, models.ImportResult{Inserted: 4, Deleted: 1}, result)
+
+			branch, err := repo.GetSwiftCode("TESTPLW1ABC")
+			require.NoError(t, err)
+			assert.Equal(t, "BRANCH", branch.Address, "The first record of a code should win")
+		})
+	}
+}
+
+// Tests storing import jobs and failing the ones left unfinished by a stopped
+// instance: without a recent heartbeat, or of the given owner.
+func TestImportJobs(t *testing.T) {
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+			job := models.ImportJob{ID: "job1", FileName: "codes.xlsx", Checksum: "ab12", Uploader: "auditor",
+				Mode: models.ImportUpsert, State: models.ImportQueued, Owner: "a", CreatedAt: created}
+			require.NoError(t, repo.CreateImport(job))
+			require.NoError(t, repo.CreateImport(models.ImportJob{ID: "job2", Mode: models.ImportInsert, State: models.ImportRunning, CreatedAt: created}))
+			require.NoError(t, repo.CreateImport(models.ImportJob{ID: "job3", Mode: models.ImportInsert, State: models.ImportQueued, CreatedAt: created.Add(time.Hour)}))
+			require.NoError(t, repo.CreateImport(models.ImportJob{ID: "job4", Mode: models.ImportInsert, State: models.ImportRunning, Owner: "b", CreatedAt: created}))
+			require.NoError(t, repo.CreateImport(models.ImportJob{ID: "job5", Mode: models.ImportInsert, State: models.ImportRunning, Owner: "c", CreatedAt: created}))
+			require.NoError(t, repo.HeartbeatImport("job4", created.Add(time.Hour)))
+			require.NoError(t, repo.HeartbeatImport("job5", created.Add(time.Hour)))
+
+			_, err := repo.GetImport("missing")
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, repo.UpdateImport(models.ImportJob{ID: "missing"}), ErrNotFound)
+
+			finished := created.Add(time.Minute)
+			job.State = models.ImportSucceeded
+			job.StartedAt = &created
+			job.FinishedAt = &finished
+			job.Progress = models.ImportProgress{RowsAccepted: 3, RowsWritten: 3}
+			job.Result = &models.ImportResult{Inserted: 3}
+			job.Report = &models.ImportReport{ID: "job1", TotalRows: 4, Accepted: 3, Rejected: 1,
+				Rejections: []models.RowRejection{{Row: 2, Reason: "bad"}}}
+			require.NoError(t, repo.UpdateImport(job))
+
+			n, err := repo.FailAbandonedImports("", created.Add(30*time.Minute), "interrupted", finished)
+			require.NoError(t, err)
+			assert.Equal(t, 1, n, "Only job2 has gone without a heartbeat for too long")
+			n, err = repo.FailAbandonedImports("c", created.Add(30*time.Minute), "interrupted", finished)
+			require.NoError(t, err)
+			assert.Equal(t, 1, n, "job5 belongs to the restarted instance")
+
+			stored, err := repo.GetImport("job1")
+			require.NoError(t, err)
+			assert.Equal(t, job.State, stored.State)
+			assert.Equal(t, "ab12", stored.Checksum)
+			assert.Equal(t, "auditor", stored.Uploader)
+			assert.Equal(t, job.Result, stored.Result)
+			assert.Equal(t, job.Report.Rejections, stored.Report.Rejections)
+			assert.True(t, finished.Equal(*stored.FinishedAt))
+
+			assert.Equal(t, "a", stored.Owner)
+
+			stored, err = repo.GetImport("job2")
+			require.NoError(t, err)
+			assert.Equal(t, models.ImportFailed, stored.State)
+			assert.Equal(t, "interrupted", stored.Error)
+			assert.NotNil(t, stored.FinishedAt)
+
+			for id, state := range map[string]models.ImportState{"job3": models.ImportQueued, "job4": models.ImportRunning, "job5": models.ImportFailed} {
+				stored, err = repo.GetImport(id)
+				require.NoError(t, err)
+				assert.Equal(t, state, stored.State, id)
+			}
+			stored, err = repo.GetImport("job4")
+			require.NoError(t, err)
+			require.NotNil(t, stored.HeartbeatAt)
+			assert.True(t, created.Add(time.Hour).Equal(*stored.HeartbeatAt))
+		})
+	}
+}
+
+// Tests that the import history is listed newest first, in pages, with the
+// summaries of the reports.
+func TestListImports(t *testing.T) {
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+			for i, id := range []string{"b", "c", "a"} {
+				require.NoError(t, repo.CreateImport(models.ImportJob{
+					ID: id, Mode: models.ImportInsert, State: models.ImportSucceeded, CreatedAt: created.Add(time.Duration(i%2) * time.Hour),
+				}))
+			}
+
+			jobs, err := repo.ListImports(10, 0)
+			require.NoError(t, err)
+			ids := []string{}
+			for _, job := range jobs {
+				ids = append(ids, job.ID)
+			}
+			assert.Equal(t, []string{"c", "b", "a"}, ids)
+
+			jobs, err = repo.ListImports(1, 1)
+			require.NoError(t, err)
+			require.Len(t, jobs, 1)
+			assert.Equal(t, "b", jobs[0].ID)
+
+			jobs, err = repo.ListImports(10, 5)
+			require.NoError(t, err)
+			assert.Empty(t, jobs)
+
+			report := &models.ImportReport{ID: "c", FileName: "codes.csv", Header: []string{"SWIFT CODE"},
+				TotalRows: 2, Accepted: 1, Rejected: 1, Rejections: []models.RowRejection{{Row: 3, Reason: "bad"}}}
+			require.NoError(t, repo.UpdateImport(models.ImportJob{
+				ID: "c", Mode: models.ImportInsert, State: models.ImportSucceeded, CreatedAt: created.Add(time.Hour), Report: report,
+			}))
+			jobs, err = repo.ListImports(1, 0)
+			require.NoError(t, err)
+			require.Len(t, jobs, 1)
+			assert.Equal(t, report.Summary(), jobs[0].Report)
+			assert.Nil(t, jobs[0].Report.Rejections)
+
+			stored, err := repo.GetImport("c")
+			require.NoError(t, err)
+			assert.Equal(t, report, stored.Report, "A single job should come with its whole report")
+		})
+	}
+}
+
+// Tests that imported records keep the import and row that last wrote
+// them, and that an update through the API clears them.
+func TestProvenance(t *testing.T) {
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			first := importFixture()
+			for i := range first {
+				first[i].ImportID = "first"
+				first[i].SourceRow = i + 2
+			}
+			_, err := repo.ImportSwiftCodes(first, models.ImportInsert)
+			require.NoError(t, err)
+
+			second := corrected()
+			for i := range second {
+				second[i].ImportID = "second"
+				second[i].SourceRow = i + 10
+			}
+			_, err = repo.ImportSwiftCodes(second, models.ImportUpsert)
+			require.NoError(t, err)
+
+			sc, err := repo.GetSwiftCode("TESTPLW1XXX")
+			require.NoError(t, err)
+			assert.Equal(t, "first", sc.ImportID, "An unchanged record keeps the import that wrote it")
+			assert.Equal(t, 2, sc.SourceRow)
+
+			sc, err = repo.GetSwiftCode("TESTPLW1ABC")
+			require.NoError(t, err)
+			assert.Equal(t, "second", sc.ImportID)
+			assert.Equal(t, 11, sc.SourceRow)
+
+			sc.Address = "MANUAL"
+			updated, err := repo.UpdateSwiftCode(*sc, 0)
+			require.NoError(t, err)
+			assert.Empty(t, updated.ImportID)
+			assert.Zero(t, updated.SourceRow)
+
+			require.NoError(t, repo.SaveSwiftCodes([]models.SwiftCodeData{
+				{SwiftCode: "MANUPLPWXXX", BankName: "MANUAL", Address: "HQ", CountryISO2: "PL", CountryName: "POLAND", IsHeadquarter: true, SourceRow: 5},
+			}))
+			sc, err = repo.GetSwiftCode("MANUPLPWXXX")
+			require.NoError(t, err)
+			assert.Empty(t, sc.ImportID)
+			assert.Zero(t, sc.SourceRow, "A row number without an import is not stored")
+		})
+	}
+}
+
+// Tests filtering a country's records by code type, time zone and town.
+func TestCountryFilter(t *testing.T) {
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			data := importFixture()
+			data[0].CodeType, data[0].TimeZone = "BIC11", "Europe/Warsaw"
+			data[1].CodeType, data[1].TimeZone = "BIC11", "Europe/Berlin"
+			data[0].Town, data[0].PostalCode = "WARSZAWA", "00-950"
+			_, err := repo.ImportSwiftCodes(data, models.ImportInsert)
+			require.NoError(t, err)
+
+			all, err := repo.GetSwiftByCountryISO2("PL", CountryFilter{}, CountryPage{})
+			require.NoError(t, err)
+			assert.Len(t, all, 2)
+
+			warsaw, err := repo.GetSwiftByCountryISO2("PL", CountryFilter{CodeType: "BIC11", TimeZone: "Europe/Warsaw"}, CountryPage{})
+			require.NoError(t, err)
+			require.Len(t, warsaw, 1)
+			assert.Equal(t, "TESTPLW1XXX", warsaw[0].SwiftCode)
+			assert.Equal(t, "Europe/Warsaw", warsaw[0].TimeZone)
+
+			warsaw, err = repo.GetSwiftByCountryISO2("PL", CountryFilter{Town: "WARSZAWA"}, CountryPage{})
+			require.NoError(t, err)
+			require.Len(t, warsaw, 1)
+			assert.Equal(t, "00-950", warsaw[0].PostalCode)
+
+			none, err := repo.GetSwiftByCountryISO2("PL", CountryFilter{CodeType: "BIC8"}, CountryPage{})
+			require.NoError(t, err)
+			assert.Empty(t, none)
+		})
+	}
+}
+
+// Tests counting headquarters and branches per country.
+func TestCountCountries(t *testing.T) {
+	for name, repo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			summaries, err := repo.CountCountries()
+			require.NoError(t, err)
+			assert.Empty(t, summaries)
+
+			_, err = repo.ImportSwiftCodes(importFixture(), models.ImportInsert)
+			require.NoError(t, err)
+
+			summaries, err = repo.CountCountries()
+			require.NoError(t, err)
+			assert.Equal(t, []models.CountrySummary{
+				{CountryISO2: "DE", CountryName: "GERMANY", Headquarters: 1},
+				{CountryISO2: "PL", CountryName: "POLAND", Headquarters: 1, Branches: 1},
+			}, summaries)
+		})
+	}
+}
@@ -0,0 +1,475 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+)
+
+// sqlRepository implements SwiftCodeRepository on top of database/sql.
+// The queries stick to SQL understood by both PostgreSQL and SQLite, so the
+// backend specific repositories only embed it and override what differs.
+type sqlRepository struct {
+	db *sql.DB
+	// rebind turns the $N placeholders used in the queries into the
+	// backend's own syntax.
+	rebind func(query string) string
+	// beginImport starts the backend's import session, which works on a
+	// staging table: COPY on PostgreSQL, plain inserts on SQLite.
+	beginImport func(mode models.ImportMode) (ImportSession, error)
+}
+
+const selectColumns = `id, swift_code, bank_name, address, town, postal_code, country_iso2, country_name,
+  is_headquarter, code_type, time_zone, version, import_id, source_row`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSwiftCode(row rowScanner) (models.SwiftCodeData, error) {
+	var (
+		sc        models.SwiftCodeData
+		importID  sql.NullString
+		sourceRow sql.NullInt64
+	)
+	err := row.Scan(
+		&sc.ID,
+		&sc.SwiftCode,
+		&sc.BankName,
+		&sc.Address,
+		&sc.Town,
+		&sc.PostalCode,
+		&sc.CountryISO2,
+		&sc.CountryName,
+		&sc.IsHeadquarter,
+		&sc.CodeType,
+		&sc.TimeZone,
+		&sc.Version,
+		&importID,
+		&sourceRow,
+	)
+	sc.ImportID = importID.String
+	sc.SourceRow = int(sourceRow.Int64)
+	return sc, err
+}
+
+// extraColumn scans the selectColumns followed by one more column into dest.
+type extraColumn struct {
+	rowScanner
+	dest interface{}
+}
+
+func (r extraColumn) Scan(dest ...interface{}) error {
+	return r.rowScanner.Scan(append(dest, r.dest)...)
+}
+
+// provenanceArgs are the import_id and source_row values of sc, NULL when
+// it was not written by an import.
+func provenanceArgs(sc models.SwiftCodeData) (sql.NullString, sql.NullInt64) {
+	if sc.ImportID == "" {
+		return sql.NullString{}, sql.NullInt64{}
+	}
+	return sql.NullString{String: sc.ImportID, Valid: true}, sql.NullInt64{Int64: int64(sc.SourceRow), Valid: sc.SourceRow > 0}
+}
+
+func scanSwiftCodes(rows *sql.Rows) ([]models.SwiftCodeData, error) {
+	defer rows.Close()
+
+	result := []models.SwiftCodeData{}
+	for rows.Next() {
+		sc, err := scanSwiftCode(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, sc)
+	}
+	return result, rows.Err()
+}
+
+func (r *sqlRepository) SaveSwiftCodes(data []models.SwiftCodeData) error {
+	_, err := r.ImportSwiftCodes(data, models.ImportInsert)
+	return err
+}
+
+func (r *sqlRepository) ImportSwiftCodes(data []models.SwiftCodeData, mode models.ImportMode) (models.ImportResult, error) {
+	session, err := r.BeginImport(mode)
+	if err != nil {
+		return models.ImportResult{}, err
+	}
+	defer session.Rollback()
+
+	if _, err := session.Write(data); err != nil {
+		return models.ImportResult{}, err
+	}
+	return session.Commit()
+}
+
+func (r *sqlRepository) BeginImport(mode models.ImportMode) (ImportSession, error) {
+	return r.beginImport(mode)
+}
+
+func (r *sqlRepository) GetSwiftCode(swiftCode string) (*models.SwiftCodeData, error) {
+	query := `
+      SELECT ` + selectColumns + `
+      FROM swift_codes
+      WHERE swift_code = $1
+      LIMIT 1
+    `
+	sc, err := scanSwiftCode(r.db.QueryRow(r.rebind(query), swiftCode))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// lookupChunkSize keeps IN lists well below the bind parameter limits of both databases.
+const lookupChunkSize = 500
+
+func (r *sqlRepository) GetSwiftCodes(codes []string) ([]models.SwiftCodeData, error) {
+	result := []models.SwiftCodeData{}
+	for start := 0; start < len(codes); start += lookupChunkSize {
+		end := start + lookupChunkSize
+		if end > len(codes) {
+			end = len(codes)
+		}
+		chunk := codes[start:end]
+
+		args := make([]interface{}, len(chunk))
+		for i, code := range chunk {
+			args[i] = code
+		}
+		query := `
+          SELECT ` + selectColumns + `
+          FROM swift_codes
+          WHERE swift_code IN (` + placeholders(1, len(chunk)) + `)
+        `
+		rows, err := r.db.Query(r.rebind(query), args...)
+		if err != nil {
+			return nil, err
+		}
+		found, err := scanSwiftCodes(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, found...)
+	}
+	return result, nil
+}
+
+func (r *sqlRepository) ListCodes() ([]string, error) {
+	rows, err := r.db.Query(`SELECT swift_code FROM swift_codes ORDER BY swift_code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+// placeholders returns "$start, $start+1, ..." with n placeholders.
+func placeholders(start, n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = "$" + strconv.Itoa(start+i)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (r *sqlRepository) GetSwiftCodesByBIC8(bic8s []string) ([]models.SwiftCodeData, error) {
+	result := []models.SwiftCodeData{}
+	for start := 0; start < len(bic8s); start += lookupChunkSize {
+		end := start + lookupChunkSize
+		if end > len(bic8s) {
+			end = len(bic8s)
+		}
+		chunk := bic8s[start:end]
+
+		args := make([]interface{}, len(chunk))
+		for i, bic8 := range chunk {
+			args[i] = bic8
+		}
+		query := `
+          SELECT ` + selectColumns + `
+          FROM swift_codes
+          WHERE substr(swift_code, 1, 8) IN (` + placeholders(1, len(chunk)) + `)
+        `
+		rows, err := r.db.Query(r.rebind(query), args...)
+		if err != nil {
+			return nil, err
+		}
+		found, err := scanSwiftCodes(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, found...)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (r *sqlRepository) GetBranchesByHQ(swiftHQ string) ([]models.SwiftCodeData, error) {
+	query := `
+        SELECT ` + selectColumns + `
+        FROM swift_codes
+        WHERE substr(swift_code, 1, 8) = $1 AND swift_code != $2
+    `
+	rows, err := r.db.Query(r.rebind(query), swiftHQ[0:8], swiftHQ)
+	if err != nil {
+		return nil, err
+	}
+	return scanSwiftCodes(rows)
+}
+
+func (r *sqlRepository) SearchSwiftCodes(q SearchQuery) ([]models.SwiftCodeData, int, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "$?", "$"+strconv.Itoa(len(args))))
+	}
+	if q.BankName != "" {
+		add(`upper(bank_name) LIKE $? ESCAPE '\'`, "%"+escapeLike(strings.ToUpper(q.BankName))+"%")
+	}
+	if q.Town != "" {
+		add(`town = $?`, q.Town)
+	}
+	if len(q.Countries) > 0 {
+		for _, iso2 := range q.Countries {
+			args = append(args, iso2)
+		}
+		conditions = append(conditions, `country_iso2 IN (`+placeholders(len(args)-len(q.Countries)+1, len(q.Countries))+`)`)
+	}
+	if q.IsHeadquarter != nil {
+		add(`is_headquarter = $?`, *q.IsHeadquarter)
+	}
+	if q.CodePrefix != "" {
+		add(`swift_code LIKE $? ESCAPE '\'`, escapeLike(q.CodePrefix)+"%")
+	}
+	if q.CodeType != "" {
+		add(`code_type = $?`, q.CodeType)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+
+	var total int
+	if err := r.db.QueryRow(r.rebind(`SELECT COUNT(*) FROM swift_codes`+where), args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	var order []string
+	for _, key := range q.Sort {
+		column, ok := sortColumns[key.Field]
+		if !ok {
+			return nil, 0, fmt.Errorf("cannot sort by %q", key.Field)
+		}
+		if key.Desc {
+			column += ` DESC`
+		}
+		order = append(order, column)
+	}
+	order = append(order, `swift_code`)
+
+	args = append(args, q.Limit, q.Offset)
+	query := `
+      SELECT ` + selectColumns + `
+      FROM swift_codes` + where + `
+      ORDER BY ` + strings.Join(order, `, `) + `
+      LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args))
+	rows, err := r.db.Query(r.rebind(query), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	page, err := scanSwiftCodes(rows)
+	return page, total, err
+}
+
+// escapeLike escapes the LIKE wildcards of s, for patterns using ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (r *sqlRepository) GetSwiftByCountryISO2(iso2 string, filter CountryFilter, page CountryPage) ([]models.SwiftCodeData, error) {
+	where, args := countryConditions(iso2, filter, page)
+	rows, err := r.db.Query(r.rebind(`
+      SELECT `+selectColumns+`
+      FROM swift_codes
+      WHERE `+where), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanSwiftCodes(rows)
+}
+
+func (r *sqlRepository) GetCountryHeadquarters(iso2 string, filter CountryFilter, page CountryPage) ([]models.Headquarter, error) {
+	where, args := countryConditions(iso2, filter, page)
+	rows, err := r.db.Query(r.rebind(`
+      SELECT `+selectColumns+`,
+             (SELECT COUNT(*) FROM swift_codes b
+              WHERE substr(b.swift_code, 1, 8) = substr(h.swift_code, 1, 8) AND b.swift_code <> h.swift_code)
+      FROM swift_codes h
+      WHERE is_headquarter AND `+where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	headquarters := []models.Headquarter{}
+	for rows.Next() {
+		var hq models.Headquarter
+		hq.SwiftCodeData, err = scanSwiftCode(extraColumn{rows, &hq.BranchCount})
+		if err != nil {
+			return nil, err
+		}
+		headquarters = append(headquarters, hq)
+	}
+	return headquarters, rows.Err()
+}
+
+// countryConditions returns the conditions, ordering and limit selecting a
+// page of a country's records matching filter, and their arguments.
+func countryConditions(iso2 string, filter CountryFilter, page CountryPage) (string, []interface{}) {
+	where := `country_iso2 = $1`
+	args := []interface{}{iso2}
+	if filter.CodeType != "" {
+		args = append(args, filter.CodeType)
+		where += ` AND code_type = $` + strconv.Itoa(len(args))
+	}
+	if filter.TimeZone != "" {
+		args = append(args, filter.TimeZone)
+		where += ` AND time_zone = $` + strconv.Itoa(len(args))
+	}
+	if filter.Town != "" {
+		args = append(args, filter.Town)
+		where += ` AND town = $` + strconv.Itoa(len(args))
+	}
+	if page.After != "" {
+		args = append(args, page.After)
+		where += ` AND swift_code > $` + strconv.Itoa(len(args))
+	}
+	where += ` ORDER BY swift_code`
+	if page.Limit > 0 {
+		args = append(args, page.Limit)
+		where += ` LIMIT $` + strconv.Itoa(len(args))
+	}
+	return where, args
+}
+
+func (r *sqlRepository) CountCountries() ([]models.CountrySummary, error) {
+	rows, err := r.db.Query(`
+      SELECT country_iso2, MAX(country_name),
+             SUM(CASE WHEN is_headquarter THEN 1 ELSE 0 END),
+             SUM(CASE WHEN is_headquarter THEN 0 ELSE 1 END)
+      FROM swift_codes
+      GROUP BY country_iso2
+      ORDER BY country_iso2
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []models.CountrySummary{}
+	for rows.Next() {
+		var s models.CountrySummary
+		if err := rows.Scan(&s.CountryISO2, &s.CountryName, &s.Headquarters, &s.Branches); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
+
+// headquarterMismatch matches the rows breaking swift_codes_headquarter_check.
+const headquarterMismatch = `is_headquarter <> (upper(swift_code) LIKE '%XXX')`
+
+func (r *sqlRepository) HeadquarterMismatches() ([]models.SwiftCodeData, error) {
+	rows, err := r.db.Query(`
+      SELECT ` + selectColumns + `
+      FROM swift_codes
+      WHERE ` + headquarterMismatch + `
+      ORDER BY swift_code
+    `)
+	if err != nil {
+		return nil, err
+	}
+	return scanSwiftCodes(rows)
+}
+
+func (r *sqlRepository) RepairHeadquarters() (int, error) {
+	res, err := r.db.Exec(`
+      UPDATE swift_codes
+      SET is_headquarter = (upper(swift_code) LIKE '%XXX'), version = version + 1
+      WHERE ` + headquarterMismatch)
+	if err != nil {
+		return 0, err
+	}
+	fixed, err := res.RowsAffected()
+	return int(fixed), err
+}
+
+func (r *sqlRepository) UpdateSwiftCode(sc models.SwiftCodeData, expectedVersion int64) (*models.SwiftCodeData, error) {
+	query := `
+      UPDATE swift_codes
+      SET bank_name = $2, address = $3, country_iso2 = $4, country_name = $5, is_headquarter = $6,
+          code_type = $7, time_zone = $8, town = $9, postal_code = $10, import_id = NULL, source_row = NULL,
+          version = version + 1
+      WHERE swift_code = $1 AND ($11 = 0 OR version = $11)
+      RETURNING ` + selectColumns
+	updated, err := scanSwiftCode(r.db.QueryRow(r.rebind(query),
+		sc.SwiftCode,
+		sc.BankName,
+		sc.Address,
+		sc.CountryISO2,
+		sc.CountryName,
+		sc.IsHeadquarter,
+		sc.CodeType,
+		sc.TimeZone,
+		sc.Town,
+		sc.PostalCode,
+		expectedVersion,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := r.GetSwiftCode(sc.SwiftCode); err != nil {
+			return nil, err
+		}
+		return nil, ErrVersionConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (r *sqlRepository) DeleteSwiftCode(swiftCode, bankName, iso2 string) error {
+	query := `
+      DELETE FROM swift_codes
+      WHERE swift_code = $1 AND bank_name = $2 AND country_iso2 = $3
+    `
+	res, err := r.db.Exec(r.rebind(query), swiftCode, bankName, iso2)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
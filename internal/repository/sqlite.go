@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+)
+
+// SQLiteRepository stores SWIFT codes in the swift_codes table of an embedded SQLite file.
+type SQLiteRepository struct {
+	*sqlRepository
+}
+
+// Imports, including SaveSwiftCodes, are staged in a temporary table so the
+// write lock is only held while they are merged, see stagedImport.
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	r := &sqlRepository{db: db, rebind: sqliteRebind}
+	r.beginImport = r.beginStagedImport
+	return &SQLiteRepository{r}
+}
+
+var placeholderPattern = regexp.MustCompile(`\$(\d+)`)
+
+// sqliteRebind rewrites $N placeholders to ?N. SQLite numbers "$N" parameters
+// by order of appearance, while "?N" keeps the explicit position.
+func sqliteRebind(query string) string {
+	return placeholderPattern.ReplaceAllString(query, "?$1")
+}
@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/fuzzy"
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+)
+
+// stagedImport is the SQLite ImportSession. SQLite has a single write lock,
+// so a transaction held for a whole file would make every other write fail
+// after the busy timeout. Batches are therefore inserted into a temporary
+// staging table on a connection of their own, which takes no lock on the
+// database file, and merged into swift_codes in one short transaction on
+// Commit. Only then do other writers wait.
+type stagedImport struct {
+	conn   *sql.Conn
+	mode   models.ImportMode
+	result models.ImportResult
+	done   bool
+}
+
+// sqliteStaging is swift_codes_staging for SQLite; seq is the rowid and
+// keeps the write order, see createStaging. The unique index on swift_code
+// turns away the duplicates of a code as they are written. words holds the
+// folded words of the search text, for the fuzzy search index.
+const sqliteStaging = `
+  CREATE TEMP TABLE swift_codes_staging (
+    seq INTEGER PRIMARY KEY,
+    swift_code TEXT NOT NULL,
+    bank_name TEXT NOT NULL,
+    address TEXT NOT NULL,
+    country_iso2 TEXT NOT NULL,
+    country_name TEXT NOT NULL,
+    is_headquarter BOOLEAN NOT NULL,
+    code_type TEXT NOT NULL,
+    time_zone TEXT NOT NULL,
+    town TEXT NOT NULL,
+    postal_code TEXT NOT NULL,
+    import_id TEXT,
+    source_row INTEGER,
+    file_row INTEGER NOT NULL,
+    words TEXT NOT NULL
+  )
+`
+
+// stagedColumns are the columns Write fills in swift_codes_staging.
+var stagedColumns = append(append([]string{}, writtenColumns...), "words")
+
+func (r *sqlRepository) beginStagedImport(mode models.ImportMode) (ImportSession, error) {
+	conn, err := r.db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	s := &stagedImport{conn: conn, mode: mode}
+	if _, err := s.exec(`DROP TABLE IF EXISTS temp.swift_codes_staging`); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := s.exec(sqliteStaging); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := s.exec(`CREATE UNIQUE INDEX temp.swift_codes_staging_code ON swift_codes_staging (swift_code)`); err != nil {
+		s.Rollback()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *stagedImport) Write(batch []models.SwiftCodeData) ([]Duplicate, error) {
+	ctx := context.Background()
+	stmt, err := s.conn.PrepareContext(ctx, sqliteRebind(`INSERT INTO swift_codes_staging (`+
+		strings.Join(stagedColumns, ", ")+`) VALUES (`+placeholders(1, len(stagedColumns))+`)
+      ON CONFLICT (swift_code) DO NOTHING`))
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	firstRow, err := s.conn.PrepareContext(ctx, `SELECT file_row FROM swift_codes_staging WHERE swift_code = ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer firstRow.Close()
+	// A batch is one transaction on the temporary database; it does not lock
+	// the database file, which is neither read nor written.
+	if _, err := s.exec(`SAVEPOINT staging`); err != nil {
+		return nil, err
+	}
+	defer s.exec(`RELEASE staging`)
+
+	var duplicates []Duplicate
+	for i, sc := range batch {
+		importID, sourceRow := provenanceArgs(sc)
+		words, err := json.Marshal(fuzzy.Words(searchText(sc)))
+		if err != nil {
+			return nil, err
+		}
+		res, err := stmt.Exec(sc.SwiftCode, sc.BankName, sc.Address, sc.CountryISO2, sc.CountryName, sc.IsHeadquarter,
+			sc.CodeType, sc.TimeZone, sc.Town, sc.PostalCode, importID, sourceRow, sc.SourceRow, string(words))
+		if err != nil {
+			return nil, err
+		}
+		if added, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if added == 0 {
+			duplicate := Duplicate{Index: i}
+			if err := firstRow.QueryRow(sc.SwiftCode).Scan(&duplicate.FirstRow); err != nil {
+				return nil, err
+			}
+			duplicates = append(duplicates, duplicate)
+		}
+	}
+	return duplicates, nil
+}
+
+func (s *stagedImport) Commit() (models.ImportResult, error) {
+	if s.done {
+		return s.result, sql.ErrTxDone
+	}
+	defer s.Rollback()
+
+	tx, err := s.conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return s.result, err
+	}
+	defer tx.Rollback()
+	if err := s.merge(tx); err != nil {
+		return s.result, err
+	}
+	return s.result, tx.Commit()
+}
+
+// merge applies the staged rows to swift_codes like copyImport.merge. The
+// triggers of migration 0012_fuzzy_search_index keep the fuzzy search index
+// of updated and deleted codes; merge indexes the inserted ones itself, from
+// the words computed by Write, which is cheaper than a trigger per row.
+func (s *stagedImport) merge(tx *sql.Tx) error {
+	exec := func(query string) (int, error) {
+		res, err := tx.Exec(query)
+		if err != nil {
+			return 0, err
+		}
+		affected, err := res.RowsAffected()
+		return int(affected), err
+	}
+
+	if s.mode == models.ImportReplace {
+		// Emptied first, the index leaves the delete trigger nothing to do.
+		if _, err := exec(`DELETE FROM swift_code_words`); err != nil {
+			return err
+		}
+		deleted, err := exec(`DELETE FROM swift_codes`)
+		if err != nil {
+			return err
+		}
+		s.result.Deleted = deleted
+	}
+
+	var changed int
+	err := tx.QueryRow(`
+      SELECT count(*) FILTER (WHERE `+sameData+`),
+             count(*) FILTER (WHERE NOT `+sameData+`)
+      FROM swift_codes_staging s
+      JOIN swift_codes c ON c.swift_code = s.swift_code
+    `).Scan(&s.result.Unchanged, &changed)
+	if err != nil {
+		return err
+	}
+
+	if s.mode == models.ImportInsert {
+		s.result.Skipped = changed
+	} else {
+		s.result.Updated, err = exec(`
+          UPDATE swift_codes AS c
+          SET bank_name = s.bank_name, address = s.address, country_iso2 = s.country_iso2,
+              country_name = s.country_name, is_headquarter = s.is_headquarter,
+              code_type = s.code_type, time_zone = s.time_zone, town = s.town, postal_code = s.postal_code,
+              import_id = s.import_id, source_row = s.source_row, version = c.version + 1
+          FROM swift_codes_staging s
+          WHERE c.swift_code = s.swift_code AND NOT ` + sameData)
+		if err != nil {
+			return err
+		}
+	}
+
+	var lastID int64
+	if err := tx.QueryRow(`SELECT COALESCE(max(id), 0) FROM swift_codes`).Scan(&lastID); err != nil {
+		return err
+	}
+	s.result.Inserted, err = exec(`
+      INSERT INTO swift_codes (` + strings.Join(stagingColumns, ", ") + `)
+      SELECT ` + strings.Join(stagingColumns, ", ") + `
+      FROM swift_codes_staging s
+      WHERE NOT EXISTS (SELECT 1 FROM swift_codes c WHERE c.swift_code = s.swift_code)
+      ORDER BY s.seq
+    `)
+	if err != nil {
+		return err
+	}
+	if err := s.indexInserted(tx, lastID); err != nil {
+		return err
+	}
+
+	if s.mode == models.ImportSync {
+		s.result.Deleted, err = exec(`
+          DELETE FROM swift_codes
+          WHERE NOT EXISTS (SELECT 1 FROM swift_codes_staging s WHERE s.swift_code = swift_codes.swift_code)
+        `)
+	}
+	return err
+}
+
+// indexInserted adds the codes inserted by merge, those with an id above
+// lastID, to the fuzzy search index, with the trigrams of their new words.
+func (s *stagedImport) indexInserted(tx *sql.Tx, lastID int64) error {
+	_, err := tx.Exec(`
+      INSERT INTO swift_code_words (word, code_id)
+      SELECT w.value, c.id
+      FROM swift_codes c
+      JOIN swift_codes_staging s ON s.swift_code = c.swift_code, json_each(s.words) w
+      WHERE c.id > ?
+    `, lastID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+      INSERT INTO swift_word_trigrams (trigram, word)
+      SELECT t.value, v.word
+      FROM (
+        SELECT DISTINCT w.word
+        FROM swift_code_words w
+        WHERE w.code_id > ?
+          AND NOT EXISTS (SELECT 1 FROM swift_word_trigrams k WHERE k.word = w.word)
+      ) v, json_each(swift_trigrams(v.word)) t
+    `, lastID)
+	return err
+}
+
+// Rollback drops the staging table and gives the connection back to the pool.
+func (s *stagedImport) Rollback() error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	_, err := s.exec(`DROP TABLE IF EXISTS temp.swift_codes_staging`)
+	if closeErr := s.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// exec runs a statement on the import's connection and returns the affected rows.
+func (s *stagedImport) exec(query string) (int, error) {
+	res, err := s.conn.ExecContext(context.Background(), query)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	return int(affected), err
+}
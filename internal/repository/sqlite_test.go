@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/database"
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests the SQLite repository on a fresh file: saving, lookups and deletion.
+func TestSQLiteRepository_Basic(t *testing.T) {
+	db, err := database.ConnectAndMigrateSQLite(filepath.Join(t.TempDir(), "swift.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewSQLiteRepository(db)
+
+	err = repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1XXX", BankName: "TEST BANK", Address: "ZAŻÓŁĆ GĘŚLĄ", CountryISO2: "PL", CountryName: "POLAND", IsHeadquarter: true},
+		{SwiftCode: "TESTPLW1ABC", BankName: "TEST BANK", CountryISO2: "PL", CountryName: "POLAND"},
+	})
+	assert.NoError(t, err)
+	err = repo.SaveSwiftCodes([]models.SwiftCodeData{{SwiftCode: "TESTPLW1XXX", BankName: "OTHER", CountryISO2: "PL"}})
+	assert.NoError(t, err, "Duplicate codes should be ignored")
+
+	sc, err := repo.GetSwiftCode("TESTPLW1XXX")
+	assert.NoError(t, err)
+	assert.Equal(t, "TEST BANK", sc.BankName)
+	assert.Equal(t, "ZAŻÓŁĆ GĘŚLĄ", sc.Address)
+	assert.True(t, sc.IsHeadquarter)
+
+	branches, err := repo.GetBranchesByHQ("TESTPLW1XXX")
+	assert.NoError(t, err)
+	assert.Len(t, branches, 1)
+
+	pl, err := repo.GetSwiftByCountryISO2("PL", CountryFilter{}, CountryPage{})
+	assert.NoError(t, err)
+	assert.Len(t, pl, 2)
+
+	assert.ErrorIs(t, repo.DeleteSwiftCode("TESTPLW1XXX", "TEST BANK", "DE"), ErrNotFound)
+	assert.NoError(t, repo.DeleteSwiftCode("TESTPLW1XXX", "TEST BANK", "PL"))
+	_, err = repo.GetSwiftCode("TESTPLW1XXX")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// Tests that a read-only file serves lookups but refuses writes.
+func TestSQLiteRepository_ReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "swift.db")
+
+	_, err := database.ConnectSQLite(path+".missing", true)
+	assert.Error(t, err, "A read-only database must already exist")
+
+	db, err := database.ConnectAndMigrateSQLite(path)
+	require.NoError(t, err)
+	err = NewSQLiteRepository(db).SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1XXX", BankName: "TEST BANK", CountryISO2: "PL", CountryName: "POLAND", IsHeadquarter: true},
+	})
+	require.NoError(t, err)
+	db.Close()
+
+	db, err = database.ConnectSQLite(path, true)
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewSQLiteRepository(db)
+
+	_, err = repo.GetSwiftCode("TESTPLW1XXX")
+	assert.NoError(t, err)
+
+	err = repo.SaveSwiftCodes([]models.SwiftCodeData{{SwiftCode: "TESTPLW2XXX"}})
+	assert.Error(t, err, "Writes should fail on a read-only database")
+}
+
+// Tests optimistic updates: the version is bumped and a stale version is refused.
+func TestSQLiteRepository_Update(t *testing.T) {
+	db, err := database.ConnectAndMigrateSQLite(filepath.Join(t.TempDir(), "swift.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewSQLiteRepository(db)
+
+	err = repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1XXX", BankName: "TEST BANK", Address: "OLD", CountryISO2: "PL", CountryName: "POLAND", IsHeadquarter: true},
+	})
+	require.NoError(t, err)
+
+	sc, err := repo.GetSwiftCode("TESTPLW1XXX")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), sc.Version)
+
+	sc.Address = "NEW"
+	updated, err := repo.UpdateSwiftCode(*sc, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "NEW", updated.Address)
+	assert.Equal(t, "TEST BANK", updated.BankName)
+	assert.Equal(t, int64(2), updated.Version)
+
+	_, err = repo.UpdateSwiftCode(*sc, 1)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	_, err = repo.UpdateSwiftCode(models.SwiftCodeData{SwiftCode: "NOPEPLW1XXX"}, 0)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// Tests that an open import session does not block other writers: they are
+// neither delayed by the busy timeout nor refused while the import is staged,
+// and a second import can run alongside.
+func TestSQLiteRepository_WritesDuringImport(t *testing.T) {
+	db, err := database.ConnectAndMigrateSQLite(filepath.Join(t.TempDir(), "swift.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewSQLiteRepository(db)
+
+	session, err := repo.BeginImport(models.ImportUpsert)
+	require.NoError(t, err)
+	defer session.Rollback()
+	_, err = session.Write(importFixture())
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, repo.CreateImport(models.ImportJob{ID: "job2", Mode: models.ImportInsert, State: models.ImportQueued, CreatedAt: start}))
+	require.NoError(t, repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "OTHRPLPWXXX", BankName: "OTHER", CountryISO2: "PL", CountryName: "POLAND", IsHeadquarter: true},
+	}))
+	other, err := repo.BeginImport(models.ImportInsert)
+	require.NoError(t, err)
+	_, err = other.Write(corrected()[2:])
+	require.NoError(t, err)
+	_, err = other.Commit()
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second, "Writes should not wait for the import")
+
+	result, err := session.Commit()
+	require.NoError(t, err)
+	assert.Equal(t, models.ImportResult{Inserted: 3}, result)
+
+	codes, err := repo.ListCodes()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"OTHRPLPWXXX", "TESTATWWXXX", "TESTDEFFXXX", "TESTPLW1ABC", "TESTPLW1XXX"}, codes)
+}
+
+// insertBeforeHeadquarterCheck stores codes with the given isHeadquarter flags
+// the way they could have been stored before the 0007_headquarter_check
+// migration, by reverting it (and any later one) for the insert.
+func insertBeforeHeadquarterCheck(t *testing.T, db *sql.DB, flags map[string]bool) {
+	m, err := database.NewMigrator(db, database.SQLite)
+	require.NoError(t, err)
+	statuses, err := m.Status()
+	require.NoError(t, err)
+	steps := 0
+	for i := len(statuses) - 1; i >= 0; i-- {
+		steps++
+		if statuses[i].Name == "headquarter_check" {
+			break
+		}
+	}
+	_, err = m.Down(steps)
+	require.NoError(t, err)
+
+	for code, isHQ := range flags {
+		_, err := db.Exec(`INSERT INTO swift_codes (swift_code, bank_name, address, country_iso2, country_name, is_headquarter)
+			VALUES (?, 'TEST BANK', '', 'PL', 'POLAND', ?)`, code, isHQ)
+		require.NoError(t, err)
+	}
+	_, err = m.Up()
+	require.NoError(t, err)
+}
+
+// Tests finding and repairing isHeadquarter flags stored before the check existed.
+func TestSQLiteRepository_RepairHeadquarters(t *testing.T) {
+	db, err := database.ConnectAndMigrateSQLite(filepath.Join(t.TempDir(), "swift.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewSQLiteRepository(db)
+
+	insertBeforeHeadquarterCheck(t, db, map[string]bool{
+		"TESTPLW1XXX": false,
+		"TESTPLW1ABC": true,
+		"TESTPLW2XXX": true,
+	})
+
+	mismatches, err := repo.HeadquarterMismatches()
+	require.NoError(t, err)
+	require.Len(t, mismatches, 2)
+	assert.Equal(t, "TESTPLW1ABC", mismatches[0].SwiftCode)
+	assert.Equal(t, "TESTPLW1XXX", mismatches[1].SwiftCode)
+
+	fixed, err := repo.RepairHeadquarters()
+	require.NoError(t, err)
+	assert.Equal(t, 2, fixed)
+
+	mismatches, err = repo.HeadquarterMismatches()
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+	sc, err := repo.GetSwiftCode("TESTPLW1XXX")
+	require.NoError(t, err)
+	assert.True(t, sc.IsHeadquarter)
+	assert.Equal(t, int64(2), sc.Version)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Fields the parser can fill, named as in the JSON representation.
+const (
+	fieldISO2        = "countryISO2"
+	fieldSwiftCode   = "swiftCode"
+	fieldCodeType    = "codeType"
+	fieldBankName    = "bankName"
+	fieldAddress     = "address"
+	fieldTown        = "town"
+	fieldPostalCode  = "postalCode"
+	fieldCountryName = "countryName"
+	fieldTimeZone    = "timeZone"
+
+	// fieldIsHeadquarter is only read from JSON imports; files derive it
+	// from the SWIFT code.
+	fieldIsHeadquarter = "isHeadquarter"
+)
+
+// requiredFields must be found in the header row, the rest may be missing.
+// The country name is not required: it is taken from the ISO 3166 reference.
+var requiredFields = []string{fieldISO2, fieldSwiftCode, fieldBankName}
+
+// ErrAmbiguousColumn is returned when one header column matches two fields.
+var ErrAmbiguousColumn = errors.New("ambiguous column")
+
+// ColumnMapping lists, for each field, the header names the column may have.
+type ColumnMapping map[string][]string
+
+// DefaultColumns are the headers of the SWIFT directory file plus common
+// names used by other providers.
+var DefaultColumns = ColumnMapping{
+	fieldISO2:        {"COUNTRY ISO2 CODE", "COUNTRY ISO2", "COUNTRY CODE", "ISO2"},
+	fieldSwiftCode:   {"SWIFT CODE", "SWIFT", "BIC", "BIC CODE", "SWIFT BIC"},
+	fieldCodeType:    {"CODE TYPE"},
+	fieldBankName:    {"NAME", "BANK NAME", "INSTITUTION NAME", "INSTITUTION"},
+	fieldAddress:     {"ADDRESS"},
+	fieldTown:        {"TOWN NAME", "TOWN", "CITY"},
+	fieldPostalCode:  {"POSTAL CODE", "POSTCODE", "ZIP CODE", "ZIP"},
+	fieldCountryName: {"COUNTRY NAME", "COUNTRY"},
+	fieldTimeZone:    {"TIME ZONE", "TIMEZONE"},
+}
+
+// ParseColumnMapping reads a JSON object mapping field names to one header
+// name or a list of them, e.g. {"swiftCode": "BIC", "town": ["CITY", "PLACE"]}.
+func ParseColumnMapping(raw string) (ColumnMapping, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, fmt.Errorf("column mapping must be a JSON object: %w", err)
+	}
+
+	mapping := make(ColumnMapping, len(values))
+	for field, value := range values {
+		if _, known := DefaultColumns[field]; !known {
+			return nil, fmt.Errorf("unknown field %q in column mapping", field)
+		}
+		var single string
+		if err := json.Unmarshal(value, &single); err == nil {
+			mapping[field] = []string{single}
+			continue
+		}
+		var list []string
+		if err := json.Unmarshal(value, &list); err != nil {
+			return nil, fmt.Errorf("column mapping for %q must be a string or a list of strings", field)
+		}
+		mapping[field] = list
+	}
+	return mapping, nil
+}
+
+// Merge returns a mapping where the aliases of other come before the ones of m.
+func (m ColumnMapping) Merge(other ColumnMapping) ColumnMapping {
+	merged := make(ColumnMapping, len(m))
+	for field, aliases := range m {
+		merged[field] = append([]string(nil), aliases...)
+	}
+	for field, aliases := range other {
+		merged[field] = append(append([]string(nil), aliases...), merged[field]...)
+	}
+	return merged
+}
+
+// MissingColumnsError is returned when the header row lacks required columns.
+type MissingColumnsError struct {
+	Missing []string
+}
+
+func (e *MissingColumnsError) Error() string {
+	return fmt.Sprintf("missing required columns: %s", strings.Join(e.Missing, ", "))
+}
+
+// resolveColumns finds the column index of every field in header. Fields
+// without a matching header are left out; missing required ones are an error.
+func resolveColumns(header []string, mapping ColumnMapping) (map[string]int, error) {
+	positions := make(map[string]int, len(header))
+	for i, title := range header {
+		key := normalizeHeader(title)
+		if _, seen := positions[key]; !seen && key != "" {
+			positions[key] = i
+		}
+	}
+
+	fields := make([]string, 0, len(mapping))
+	for field := range mapping {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	columns := make(map[string]int)
+	claimedBy := make(map[int]string)
+	for _, field := range fields {
+		for _, alias := range mapping[field] {
+			idx, ok := positions[normalizeHeader(alias)]
+			if !ok {
+				continue
+			}
+			if other, taken := claimedBy[idx]; taken {
+				return nil, fmt.Errorf("%w: %q matches both %s and %s", ErrAmbiguousColumn, header[idx], other, field)
+			}
+			columns[field] = idx
+			claimedBy[idx] = field
+			break
+		}
+	}
+
+	var missing []string
+	for _, field := range requiredFields {
+		if _, ok := columns[field]; !ok {
+			missing = append(missing, fmt.Sprintf("%s (%s)", DefaultColumns[field][0], field))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &MissingColumnsError{Missing: missing}
+	}
+	return columns, nil
+}
+
+// normalizeHeader makes header matching ignore case, surrounding spaces,
+// repeated spaces and the separators "_", "-" and "/".
+func normalizeHeader(title string) string {
+	title = strings.ToUpper(title)
+	title = strings.NewReplacer("_", " ", "-", " ", "/", " ").Replace(title)
+	return strings.Join(strings.Fields(title), " ")
+}
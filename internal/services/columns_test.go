@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that a mapping accepts single names and lists, and rejects unknown fields.
+func TestParseColumnMapping(t *testing.T) {
+	mapping, err := ParseColumnMapping(`{"swiftCode": "BIC11", "town": ["PLACE", "LOCALITY"]}`)
+	require.NoError(t, err)
+	assert.Equal(t, ColumnMapping{"swiftCode": {"BIC11"}, "town": {"PLACE", "LOCALITY"}}, mapping)
+
+	mapping, err = ParseColumnMapping("  ")
+	assert.NoError(t, err)
+	assert.Nil(t, mapping)
+
+	_, err = ParseColumnMapping(`{"swift": "BIC11"}`)
+	assert.Error(t, err)
+	_, err = ParseColumnMapping(`{"swiftCode": 11}`)
+	assert.Error(t, err)
+	_, err = ParseColumnMapping(`["BIC11"]`)
+	assert.Error(t, err)
+}
+
+// Tests header matching, alias precedence and ambiguous columns.
+func TestResolveColumns(t *testing.T) {
+	header := []string{"iso2", "Swift_Code", " Bank  Name ", "Country", "BIC"}
+
+	columns, err := resolveColumns(header, DefaultColumns)
+	require.NoError(t, err)
+	assert.Equal(t, 0, columns[fieldISO2])
+	assert.Equal(t, 1, columns[fieldSwiftCode])
+	assert.Equal(t, 2, columns[fieldBankName])
+	assert.Equal(t, 3, columns[fieldCountryName])
+	assert.NotContains(t, columns, fieldTown)
+
+	columns, err = resolveColumns(header, DefaultColumns.Merge(ColumnMapping{fieldSwiftCode: {"BIC"}}))
+	require.NoError(t, err)
+	assert.Equal(t, 4, columns[fieldSwiftCode], "Overrides should take precedence over defaults")
+
+	_, err = resolveColumns(header, DefaultColumns.Merge(ColumnMapping{fieldTown: {"BIC"}, fieldSwiftCode: {"BIC"}}))
+	assert.ErrorIs(t, err, ErrAmbiguousColumn)
+}
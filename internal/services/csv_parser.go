@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Encoding names accepted in ParseOptions.Encoding.
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingWindows1250 = "windows-1250"
+	EncodingLatin1      = "iso-8859-1"
+)
+
+// ErrUnsupportedEncoding is returned for an encoding name not in encodings.
+var ErrUnsupportedEncoding = errors.New("unsupported encoding")
+
+var encodings = map[string]encoding.Encoding{
+	EncodingUTF8:        encoding.Nop,
+	"utf8":              encoding.Nop,
+	EncodingWindows1250: charmap.Windows1250,
+	"cp1250":            charmap.Windows1250,
+	EncodingLatin1:      charmap.ISO8859_1,
+	"latin-1":           charmap.ISO8859_1,
+	"latin1":            charmap.ISO8859_1,
+	"iso-8859-2":        charmap.ISO8859_2,
+	"latin-2":           charmap.ISO8859_2,
+	"latin2":            charmap.ISO8859_2,
+	"windows-1252":      charmap.Windows1252,
+}
+
+// candidateDelimiters are tried, in order of preference on ties, when the
+// delimiter of a CSV file is not given.
+var candidateDelimiters = []rune{',', ';', '\t', '|'}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// sniffSize is how much of a CSV file is looked at to detect its encoding
+// and delimiter.
+const sniffSize = 64 * 1024
+
+// ParseSwiftCSVWithReport parses a CSV or TSV file into the same records and
+// report as ParseSwiftXLSXWithReport. The encoding and delimiter are detected
+// unless set in opts.
+func ParseSwiftCSVWithReport(filePath string, opts ParseOptions) ([]models.SwiftCodeData, *models.ImportReport, error) {
+	return collect(func(fn RecordFunc) (*models.ImportReport, error) {
+		return StreamSwiftCSV(filePath, opts, fn)
+	})
+}
+
+// StreamSwiftCSV reads a CSV or TSV file record by record. The encoding and
+// delimiter are detected from the start of the file.
+func StreamSwiftCSV(filePath string, opts ParseOptions, fn RecordFunc) (*models.ImportReport, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	br := bufio.NewReaderSize(file, sniffSize)
+	if bom, _ := br.Peek(len(utf8BOM)); bytes.Equal(bom, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+	sample, err := br.Peek(sniffSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, err
+	}
+
+	enc, err := lookupEncoding(opts.Encoding, sample, len(sample) < sniffSize)
+	if err != nil {
+		return nil, err
+	}
+	var text io.Reader = br
+	if enc != encoding.Nop {
+		text = enc.NewDecoder().Reader(br)
+	}
+
+	delimiter := opts.Delimiter
+	if delimiter == 0 {
+		if opts.Format == FormatTSV || DetectFormat(filePath, "") == FormatTSV {
+			delimiter = '\t'
+		} else {
+			decoded, _ := enc.NewDecoder().Bytes(sample)
+			delimiter = detectDelimiter(string(decoded))
+		}
+	}
+
+	reader := csv.NewReader(text)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+
+	report := &models.ImportReport{
+		FileName:   filepath.Base(filePath),
+		Rejections: []models.RowRejection{},
+	}
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	parser, err := newRowParser(append([]string(nil), header...), opts, report)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			report.TotalRows++
+			report.Reject(models.RowRejection{Row: parseErr.StartLine, Reason: parseErr.Err.Error(), Values: append([]string(nil), row...)})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if record, ok := parser.parse(row, line); ok {
+			if err := fn(record); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// lookupEncoding returns the encoding called name. An empty name detects it
+// from sample: valid UTF-8 (a rune cut at the end of a partial sample
+// allowed) is kept, otherwise Windows-1250 or Latin-1 is picked by which of
+// them reads as more letters.
+func lookupEncoding(name string, sample []byte, complete bool) (encoding.Encoding, error) {
+	if name != "" {
+		enc, ok := encodings[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, name)
+		}
+		return enc, nil
+	}
+
+	if !complete {
+		sample = trimPartialRune(sample)
+	}
+	if utf8.Valid(sample) {
+		return encoding.Nop, nil
+	}
+
+	// Both are single-byte encodings, so decoding cannot fail. Latin-1 maps
+	// 0x80-0x9F to control characters and most of Windows-1250's Polish
+	// letters (ą ł ś ż ...) to symbols, so Polish text scores higher as
+	// Windows-1250; Latin-1 wins ties.
+	cp1250, _ := charmap.Windows1250.NewDecoder().Bytes(sample)
+	latin1, _ := charmap.ISO8859_1.NewDecoder().Bytes(sample)
+	if countNonASCIILetters(cp1250) > countNonASCIILetters(latin1) {
+		return charmap.Windows1250, nil
+	}
+	return charmap.ISO8859_1, nil
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence at the end of b.
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+func countNonASCIILetters(text []byte) int {
+	count := 0
+	for _, r := range string(text) {
+		if r > unicode.MaxASCII && unicode.IsLetter(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// detectDelimiter picks the candidate delimiter occurring most often in the
+// header line, ignoring quoted parts.
+func detectDelimiter(content string) rune {
+	line := content
+	if i := strings.IndexAny(content, "\r\n"); i >= 0 {
+		line = content[:i]
+	}
+
+	counts := make(map[rune]int)
+	quoted := false
+	for _, r := range line {
+		if r == '"' {
+			quoted = !quoted
+			continue
+		}
+		if !quoted {
+			counts[r]++
+		}
+	}
+
+	best := candidateDelimiters[0]
+	for _, d := range candidateDelimiters[1:] {
+		if counts[d] > counts[best] {
+			best = d
+		}
+	}
+	return best
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests a UTF-8 CSV with a BOM and a quoted address containing the delimiter.
+func TestParseSwiftCSV_Basic(t *testing.T) {
+	testFile := filepath.Join("testdata", "test_basic.csv")
+
+	records, report, err := ParseSwiftFile(testFile, ParseOptions{})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, 0, report.Rejected)
+
+	hq := records[0]
+	assert.Equal(t, "BPKOPLPWXXX", hq.SwiftCode)
+	assert.Equal(t, "UL. PUŁAWSKA 15, PIĘTRO 2", hq.Address)
+	assert.Equal(t, "WARSZAWA", hq.Town)
+	assert.Equal(t, "PL", hq.CountryISO2)
+	assert.Equal(t, "POLAND", hq.CountryName)
+	assert.True(t, hq.IsHeadquarter)
+	assert.Equal(t, "BIC11", hq.CodeType)
+	assert.Equal(t, "Europe/Warsaw", hq.TimeZone)
+	assert.Equal(t, "RYNEK GŁÓWNY 31", records[1].Address)
+	assert.Equal(t, "KRAKÓW", records[1].Town)
+}
+
+// Tests that a row with an unknown time zone is rejected.
+func TestParseSwiftCSV_UnknownTimeZone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zones.csv")
+	content := "COUNTRY ISO2 CODE,SWIFT CODE,CODE TYPE,NAME,COUNTRY NAME,TIME ZONE\n" +
+		"PL,BREXPLPWXXX,bic11,MBANK S.A.,POLAND,Europe/Warsaw\n" +
+		"PL,BREXPLPWLOD,BIC11,MBANK S.A.,POLAND,Europe/Lodz\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	records, report, err := ParseSwiftFile(path, ParseOptions{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "BIC11", records[0].CodeType)
+	require.Equal(t, 1, report.Rejected)
+	assert.Equal(t, "TIME ZONE", report.Rejections[0].Column)
+	assert.Equal(t, 3, report.Rejections[0].Row)
+}
+
+// Tests that a semicolon-separated Windows-1250 file keeps its Polish diacritics.
+func TestParseSwiftCSV_Windows1250(t *testing.T) {
+	testFile := filepath.Join("testdata", "test_cp1250.csv")
+
+	records, _, err := ParseSwiftFile(testFile, ParseOptions{})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "UL. ŻÓŁKIEWSKIEGO 12, ŚRÓDMIEŚCIE", records[0].Address)
+	assert.Equal(t, "ŁÓDŹ", records[0].Town)
+
+	records, _, err = ParseSwiftFile(testFile, ParseOptions{Encoding: "windows-1250", Delimiter: ';'})
+	require.NoError(t, err)
+	assert.Equal(t, "UL. ŻÓŁKIEWSKIEGO 12, ŚRÓDMIEŚCIE", records[0].Address)
+	assert.Equal(t, "ŁÓDŹ", records[0].Town)
+}
+
+// Tests that a Latin-1 TSV is read with tabs and decoded.
+func TestParseSwiftCSV_Latin1TSV(t *testing.T) {
+	testFile := filepath.Join("testdata", "test_latin1.tsv")
+
+	records, _, err := ParseSwiftFile(testFile, ParseOptions{})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "PROMENADEPLATZ 15", records[0].Address)
+	assert.Equal(t, "MÜNCHEN", records[0].Town)
+	assert.Equal(t, "BNPAFRPPXXX", records[1].SwiftCode)
+}
+
+// Tests that CSV rows are rejected with the same report as the .xlsx equivalent.
+func TestParseSwiftCSV_InvalidRows(t *testing.T) {
+	_, xlsxReport, err := ParseSwiftFile(filepath.Join("testdata", "test_invalid_rows.xlsx"), ParseOptions{})
+	require.NoError(t, err)
+
+	records, report, err := ParseSwiftFile(filepath.Join("testdata", "test_invalid_rows.csv"), ParseOptions{})
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, xlsxReport.TotalRows, report.TotalRows)
+	assert.Equal(t, xlsxReport.Rejected, report.Rejected)
+	for i, rejection := range report.Rejections {
+		assert.Equal(t, xlsxReport.Rejections[i].Row, rejection.Row)
+		assert.Equal(t, xlsxReport.Rejections[i].Column, rejection.Column)
+	}
+}
+
+// Tests that an unknown encoding name is an error.
+func TestParseSwiftCSV_UnsupportedEncoding(t *testing.T) {
+	_, _, err := ParseSwiftFile(filepath.Join("testdata", "test_basic.csv"), ParseOptions{Encoding: "ebcdic"})
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+}
+
+// Tests format detection by content type first, then extension.
+func TestDetectFormat(t *testing.T) {
+	assert.Equal(t, FormatCSV, DetectFormat("feed.txt", "text/csv; charset=windows-1250"))
+	assert.Equal(t, FormatTSV, DetectFormat("feed", "text/tab-separated-values"))
+	assert.Equal(t, FormatCSV, DetectFormat("feed.CSV", "application/vnd.ms-excel"))
+	assert.Equal(t, FormatXLSX, DetectFormat("feed.xlsx", "application/octet-stream"))
+	assert.Equal(t, FileFormat(""), DetectFormat("feed.pdf", "application/pdf"))
+}
+
+// Tests that the delimiter is the most frequent candidate outside quotes.
+func TestDetectDelimiter(t *testing.T) {
+	assert.Equal(t, ';', detectDelimiter("A;B;\"C,D,E\"\n1;2;3"))
+	assert.Equal(t, ',', detectDelimiter("A,B,C"))
+	assert.Equal(t, '\t', detectDelimiter("A\tB\tC\r\n"))
+	assert.Equal(t, ',', detectDelimiter("SINGLE"))
+}
+
+// Tests that town and postal code are kept apart from the address, also
+// when the address is empty.
+func TestParseSwiftCSV_TownAndPostalCode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "towns.csv")
+	content := "COUNTRY ISO2 CODE,SWIFT CODE,NAME,ADDRESS,TOWN NAME,POSTAL CODE,COUNTRY NAME\n" +
+		"PL,BREXPLPWXXX,MBANK S.A.,UL. PROSTA 18,warszawa,00-850,POLAND\n" +
+		"PL,BREXPLPWLOD,MBANK S.A.,,ŁÓDŹ,,POLAND\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	records, _, err := ParseSwiftFile(path, ParseOptions{})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "UL. PROSTA 18", records[0].Address)
+	assert.Equal(t, "WARSZAWA", records[0].Town)
+	assert.Equal(t, "00-850", records[0].PostalCode)
+	assert.Equal(t, "", records[1].Address, "An empty address must not become \", TOWN\"")
+	assert.Equal(t, "ŁÓDŹ", records[1].Town)
+}
+
+// Tests that a structurally invalid SWIFT code is rejected on its column and a
+// code from another country on the country column.
+func TestParseSwiftCSV_InvalidBIC(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bics.csv")
+	content := "COUNTRY ISO2 CODE,SWIFT CODE,NAME,COUNTRY NAME\n" +
+		"PL,BR3XPLPWXXX,MBANK S.A.,POLAND\n" +
+		"DE,BREXPLPWXXX,MBANK S.A.,GERMANY\n" +
+		"PL,BREXPLPWXXX,MBANK S.A.,POLAND\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	records, report, err := ParseSwiftCSVWithReport(path, ParseOptions{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Len(t, report.Rejections, 2)
+	assert.Equal(t, "SWIFT CODE", report.Rejections[0].Column)
+	assert.Contains(t, report.Rejections[0].Reason, "institution code")
+	assert.Equal(t, "COUNTRY ISO2 CODE", report.Rejections[1].Column)
+	assert.Contains(t, report.Rejections[1].Reason, "does not match")
+}
+
+// Tests that the country name is taken from the ISO 3166 reference, also when the column is missing.
+func TestParseSwiftCSV_CountryName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "names.csv")
+	content := "COUNTRY ISO2 CODE,SWIFT CODE,NAME,COUNTRY NAME\n" +
+		"PL,BREXPLPWXXX,MBANK S.A.,POLSKA\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	records, _, err := ParseSwiftFile(path, ParseOptions{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "POLAND", records[0].CountryName)
+
+	content = "COUNTRY ISO2 CODE,SWIFT CODE,NAME\n" +
+		"DE,DEUTDEFFXXX,DEUTSCHE BANK\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	records, _, err = ParseSwiftFile(path, ParseOptions{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "GERMANY", records[0].CountryName)
+}
+
+// Tests that codes are stored trimmed and upper-cased, so differently written duplicates are caught.
+func TestParseSwiftCSV_NormalizedCode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "codes.csv")
+	content := "COUNTRY ISO2 CODE,SWIFT CODE,NAME\n" +
+		"PL,brexplpwxxx,MBANK S.A.\n" +
+		"PL, BREXPLPWXXX ,MBANK S.A.\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	records, report, err := ParseSwiftCSVWithReport(path, ParseOptions{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "BREXPLPWXXX", records[0].SwiftCode)
+	assert.True(t, records[0].IsHeadquarter)
+	require.Len(t, report.Rejections, 1)
+	assert.Contains(t, report.Rejections[0].Reason, "duplicate")
+}
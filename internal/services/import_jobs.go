@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/Mekambee/Swift-Codes-Api/internal/repository"
+)
+
+var (
+	// ErrImportNotFound is returned for unknown import job IDs.
+	ErrImportNotFound = errors.New("import not found")
+	// ErrImportFinished is returned when cancelling a job that already ended.
+	ErrImportFinished = errors.New("import already finished")
+	// ErrImportNotRunning is returned when cancelling an unfinished job that
+	// another server instance is executing.
+	ErrImportNotRunning = errors.New("import is not running on this server")
+)
+
+// importProgress is updated by the import goroutine and read by requests.
+type importProgress struct {
+	accepted atomic.Int64
+	written  atomic.Int64
+}
+
+func (p *importProgress) snapshot() models.ImportProgress {
+	return models.ImportProgress{
+		RowsAccepted: int(p.accepted.Load()),
+		RowsWritten:  int(p.written.Load()),
+	}
+}
+
+// runningImport is an import job executed by this process.
+type runningImport struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	progress importProgress
+}
+
+const (
+	// ImportHeartbeat is how often a running job stores a heartbeat.
+	ImportHeartbeat = 30 * time.Second
+	// ImportLease is how long a job may go without a heartbeat before other
+	// instances take its owner for stopped and fail it.
+	ImportLease = 2 * time.Minute
+)
+
+// SetInstanceID names this server instance, recorded as the owner of the
+// jobs it runs. It must differ from the ID of every other running instance.
+func (s *SwiftService) SetInstanceID(id string) {
+	s.instanceID = id
+}
+
+// newImportJob returns a queued job of this instance with a new ID, taking
+// the file name, checksum, uploader and mode from info.
+func (s *SwiftService) newImportJob(info models.ImportJob) models.ImportJob {
+	now := time.Now().UTC()
+	return models.ImportJob{
+		ID:          newReportID(),
+		FileName:    info.FileName,
+		Checksum:    info.Checksum,
+		Uploader:    info.Uploader,
+		Mode:        info.Mode,
+		State:       models.ImportQueued,
+		Owner:       s.instanceID,
+		HeartbeatAt: &now,
+		CreatedAt:   now,
+	}
+}
+
+// keepAlive stores a heartbeat for the job every s.heartbeat until the
+// returned function is called.
+func (s *SwiftService) keepAlive(id string) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(s.heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case at := <-ticker.C:
+				if err := s.repo.HeartbeatImport(id, at.UTC()); err != nil {
+					log.Printf("Import %s: cannot store heartbeat: %v\n", id, err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// StartImport records a queued job and imports the file in the background.
+// info describes the upload: its FileName, Checksum, Uploader and Mode.
+// The job takes over filePath and removes it when done. Progress is only
+// kept in memory while the job runs; the stored job changes state when it
+// starts and when it ends.
+func (s *SwiftService) StartImport(filePath string, opts ParseOptions, info models.ImportJob) (*models.ImportJob, error) {
+	job := s.newImportJob(info)
+	if err := s.repo.CreateImport(job); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &runningImport{ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	s.runningMu.Lock()
+	s.running[job.ID] = run
+	s.runningMu.Unlock()
+
+	go s.runImport(job, run, filePath, opts)
+	return &job, nil
+}
+
+func (s *SwiftService) runImport(job models.ImportJob, run *runningImport, filePath string, opts ParseOptions) {
+	stop := s.keepAlive(job.ID)
+	defer func() {
+		stop()
+		os.Remove(filePath)
+		s.runningMu.Lock()
+		delete(s.running, job.ID)
+		s.runningMu.Unlock()
+		run.cancel()
+		close(run.done)
+	}()
+
+	started := time.Now().UTC()
+	job.State = models.ImportRunning
+	job.StartedAt = &started
+	job.HeartbeatAt = &started
+	if err := s.repo.UpdateImport(job); err != nil {
+		log.Printf("Import %s: cannot record start: %v\n", job.ID, err)
+	}
+
+	result, report, err := s.importFile(run.ctx, job.ID, filePath, opts, job.Mode, &run.progress)
+	s.finishImport(&job, &run.progress, result, report, err)
+}
+
+// finishImport records the outcome of an import on job and stores it.
+func (s *SwiftService) finishImport(job *models.ImportJob, progress *importProgress, result models.ImportResult, report *models.ImportReport, err error) {
+	finished := time.Now().UTC()
+	job.FinishedAt = &finished
+	job.HeartbeatAt = &finished
+	job.Progress = progress.snapshot()
+	switch {
+	case errors.Is(err, context.Canceled):
+		job.State = models.ImportCancelled
+	case err != nil:
+		job.State = models.ImportFailed
+		job.Error = err.Error()
+	default:
+		job.State = models.ImportSucceeded
+		report.ID = job.ID
+		report.FileName = job.FileName
+		job.Result = &result
+		job.Report = report
+	}
+	if err := s.repo.UpdateImport(*job); err != nil {
+		log.Printf("Import %s: cannot record outcome %s: %v\n", job.ID, job.State, err)
+	}
+}
+
+// ListImports returns the history of imports, newest first, with the
+// summaries of their reports; the rejected rows are part of the single job.
+func (s *SwiftService) ListImports(limit, offset int) ([]models.ImportJob, error) {
+	jobs, err := s.repo.ListImports(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	for i := range jobs {
+		if run, ok := s.running[jobs[i].ID]; ok && !jobs[i].State.Finished() {
+			jobs[i].Progress = run.progress.snapshot()
+		}
+	}
+	return jobs, nil
+}
+
+// GetImport returns an import job, with live progress if it is running here.
+func (s *SwiftService) GetImport(id string) (*models.ImportJob, error) {
+	job, err := s.repo.GetImport(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrImportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.runningMu.Lock()
+	run, ok := s.running[id]
+	s.runningMu.Unlock()
+	if ok && !job.State.Finished() {
+		job.Progress = run.progress.snapshot()
+	}
+	return job, nil
+}
+
+// CancelImport stops a running job, waits for its rollback and returns it.
+func (s *SwiftService) CancelImport(id string) (*models.ImportJob, error) {
+	s.runningMu.Lock()
+	run, ok := s.running[id]
+	s.runningMu.Unlock()
+
+	if !ok {
+		job, err := s.GetImport(id)
+		if err != nil {
+			return nil, err
+		}
+		if job.State.Finished() {
+			return nil, ErrImportFinished
+		}
+		return nil, ErrImportNotRunning
+	}
+
+	run.cancel()
+	<-run.done
+	job, err := s.GetImport(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.State != models.ImportCancelled {
+		return nil, ErrImportFinished
+	}
+	return job, nil
+}
+
+// RecoverImports marks as failed the unfinished jobs whose instance stopped:
+// those of a previous run of this instance, and those without a heartbeat
+// for longer than ImportLease. Their transaction was rolled back when the
+// instance stopped. Jobs of other running instances are left alone.
+func (s *SwiftService) RecoverImports() (int, error) {
+	now := time.Now().UTC()
+	return s.repo.FailAbandonedImports(s.instanceID, now.Add(-s.importLease), "interrupted by a server restart", now)
+}
+
+// WatchImports fails, every ImportHeartbeat until ctx is done, the jobs of
+// other instances that stopped sending heartbeats, e.g. because they crashed
+// and did not come back.
+func (s *SwiftService) WatchImports(ctx context.Context) {
+	ticker := time.NewTicker(s.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case at := <-ticker.C:
+			at = at.UTC()
+			failed, err := s.repo.FailAbandonedImports("", at.Add(-s.importLease), "its server instance stopped", at)
+			if err != nil {
+				log.Printf("Cannot check for abandoned imports: %v\n", err)
+			} else if failed > 0 {
+				log.Printf("Marked %d import(s) abandoned by a stopped instance as failed\n", failed)
+			}
+		}
+	}
+}
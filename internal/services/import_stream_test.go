@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/Mekambee/Swift-Codes-Api/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchRecorder wraps a repository to record the size of every written batch.
+type batchRecorder struct {
+	repository.SwiftCodeRepository
+	batches []int
+}
+
+func (r *batchRecorder) BeginImport(mode models.ImportMode) (repository.ImportSession, error) {
+	session, err := r.SwiftCodeRepository.BeginImport(mode)
+	return &recordingSession{ImportSession: session, recorder: r}, err
+}
+
+type recordingSession struct {
+	repository.ImportSession
+	recorder *batchRecorder
+}
+
+func (s *recordingSession) Write(batch []models.SwiftCodeData) ([]repository.Duplicate, error) {
+	s.recorder.batches = append(s.recorder.batches, len(batch))
+	return s.ImportSession.Write(batch)
+}
+
+// writeCSV writes a CSV file with n valid rows and returns its path.
+func writeCSV(t *testing.T, n int) string {
+	var b strings.Builder
+	b.WriteString("COUNTRY ISO2 CODE,SWIFT CODE,NAME,ADDRESS,TOWN NAME,COUNTRY NAME\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "PL,%s,BANK %d,STREET %d,WARSZAWA,POLAND\n", testBIC(i), i, i)
+	}
+	path := filepath.Join(t.TempDir(), "codes.csv")
+	require.NoError(t, os.WriteFile(path, []byte(b.String()), 0o600))
+	return path
+}
+
+// testBIC returns the i-th of distinct valid Polish SWIFT codes, for i < 26^4.
+func testBIC(i int) string {
+	institution := make([]byte, 4)
+	for j := len(institution) - 1; j >= 0; j-- {
+		institution[j] = byte('A' + i%26)
+		i /= 26
+	}
+	return string(institution) + "PLPWXXX"
+}
+
+// Tests that a file is written in batches of importBatchSize within one session.
+func TestImportFile_Batches(t *testing.T) {
+	repo := &batchRecorder{SwiftCodeRepository: repository.NewMemoryRepository()}
+	service := NewSwiftService(repo)
+
+	result, report, err := service.ImportFile(writeCSV(t, 1000), ParseOptions{}, models.ImportInsert)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, result.Inserted)
+	assert.Equal(t, 1000, report.Accepted)
+	assert.Equal(t, []int{importBatchSize}, repo.batches)
+
+	repo.batches = nil
+	rows := importBatchSize*2 + 1
+	result, _, err = service.ImportFile(writeCSV(t, rows), ParseOptions{}, models.ImportUpsert)
+	require.NoError(t, err)
+	assert.Equal(t, rows-1000, result.Inserted)
+	assert.Equal(t, 1000, result.Unchanged)
+	assert.Equal(t, []int{importBatchSize, importBatchSize, 1}, repo.batches)
+}
+
+// Tests that a code repeated in a later batch is rejected, pointing at its
+// first row, and that the report only keeps MaxRejections rows but counts all.
+func TestImportFile_Duplicates(t *testing.T) {
+	service := NewSwiftService(repository.NewMemoryRepository())
+	rows := importBatchSize + models.MaxRejections + 1
+	path := writeCSV(t, importBatchSize)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	for i := importBatchSize; i < rows; i++ {
+		fmt.Fprintf(file, "PL,%s,BANK %d,STREET %d,WARSZAWA,POLAND\n", testBIC(i%importBatchSize), i, i)
+	}
+	require.NoError(t, file.Close())
+
+	result, report, err := service.ImportFile(path, ParseOptions{}, models.ImportInsert)
+	require.NoError(t, err)
+	assert.Equal(t, importBatchSize, result.Inserted)
+	assert.Equal(t, rows, report.TotalRows)
+	assert.Equal(t, importBatchSize, report.Accepted)
+	assert.Equal(t, rows-importBatchSize, report.Rejected)
+	require.Len(t, report.Rejections, models.MaxRejections)
+	first := report.Rejections[0]
+	assert.Equal(t, importBatchSize+2, first.Row)
+	assert.Equal(t, "SWIFT CODE", first.Column)
+	assert.Equal(t, "duplicate SWIFT code, first seen in row 2", first.Reason)
+	assert.Equal(t, testBIC(0), first.Values[1])
+}
+
+// Tests that a file failing to parse leaves the stored data untouched, even in replace mode.
+func TestImportFile_FailedFileKeepsData(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	service := NewSwiftService(repo)
+	_, _, err := service.ImportFile(writeCSV(t, 10), ParseOptions{}, models.ImportInsert)
+	require.NoError(t, err)
+
+	_, _, err = service.ImportFile(filepath.Join("testdata", "test_custom_headers.xlsx"), ParseOptions{}, models.ImportReplace)
+	var missing *MissingColumnsError
+	assert.ErrorAs(t, err, &missing)
+
+	codes, err := repo.ListCodes()
+	require.NoError(t, err)
+	assert.Len(t, codes, 10)
+}
+
+// blockingRepo holds every import write until the import is cancelled.
+type blockingRepo struct {
+	repository.SwiftCodeRepository
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingRepo) BeginImport(mode models.ImportMode) (repository.ImportSession, error) {
+	session, err := r.SwiftCodeRepository.BeginImport(mode)
+	return &blockingSession{ImportSession: session, repo: r}, err
+}
+
+type blockingSession struct {
+	repository.ImportSession
+	repo *blockingRepo
+}
+
+func (s *blockingSession) Write(batch []models.SwiftCodeData) ([]repository.Duplicate, error) {
+	close(s.repo.writing)
+	<-s.repo.release
+	return s.ImportSession.Write(batch)
+}
+
+// Tests that cancelling a running job rolls back its import.
+func TestCancelImport(t *testing.T) {
+	memory := repository.NewMemoryRepository()
+	repo := &blockingRepo{SwiftCodeRepository: memory, writing: make(chan struct{}), release: make(chan struct{})}
+	service := NewSwiftService(repo)
+
+	job, err := service.StartImport(writeCSV(t, importBatchSize+10), ParseOptions{}, models.ImportJob{FileName: "codes.csv", Mode: models.ImportInsert})
+	require.NoError(t, err)
+	assert.Equal(t, models.ImportQueued, job.State)
+
+	service.runningMu.Lock()
+	ctx := service.running[job.ID].ctx
+	service.runningMu.Unlock()
+	go func() {
+		<-ctx.Done()
+		close(repo.release)
+	}()
+	<-repo.writing
+
+	running, err := service.GetImport(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ImportRunning, running.State)
+	assert.Equal(t, importBatchSize, running.Progress.RowsAccepted)
+
+	cancelled, err := service.CancelImport(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ImportCancelled, cancelled.State)
+	assert.NotNil(t, cancelled.FinishedAt)
+
+	codes, err := memory.ListCodes()
+	require.NoError(t, err)
+	assert.Empty(t, codes, "A cancelled import should store nothing")
+
+	_, err = service.CancelImport(job.ID)
+	assert.ErrorIs(t, err, ErrImportFinished)
+	_, err = service.CancelImport("missing")
+	assert.ErrorIs(t, err, ErrImportNotFound)
+}
+
+// Tests that jobs left unfinished by a previous process are failed, and that
+// one unfinished here but unknown to this process cannot be cancelled.
+func TestRecoverImports(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	require.NoError(t, repo.CreateImport(models.ImportJob{ID: "stale", State: models.ImportRunning}))
+	service := NewSwiftService(repo)
+
+	_, err := service.CancelImport("stale")
+	assert.ErrorIs(t, err, ErrImportNotRunning)
+
+	n, err := service.RecoverImports()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	job, err := service.GetImport("stale")
+	require.NoError(t, err)
+	assert.Equal(t, models.ImportFailed, job.State)
+	assert.NotEmpty(t, job.Error)
+}
+
+// Tests that an instance starting up leaves the jobs another live instance is
+// running alone, while failing its own from before the restart and the ones
+// whose instance stopped sending heartbeats.
+func TestRecoverImports_Instances(t *testing.T) {
+	memory := repository.NewMemoryRepository()
+	repo := &blockingRepo{SwiftCodeRepository: memory, writing: make(chan struct{}), release: make(chan struct{})}
+	running := NewSwiftService(repo)
+	running.SetInstanceID("a")
+	running.heartbeat = 10 * time.Millisecond
+
+	job, err := running.StartImport(writeCSV(t, importBatchSize+10), ParseOptions{}, models.ImportJob{FileName: "codes.csv", Mode: models.ImportInsert})
+	require.NoError(t, err)
+	assert.Equal(t, "a", job.Owner)
+	running.runningMu.Lock()
+	runCtx := running.running[job.ID].ctx
+	running.runningMu.Unlock()
+	go func() {
+		<-runCtx.Done()
+		close(repo.release)
+	}()
+	<-repo.writing
+	defer running.CancelImport(job.ID)
+
+	created := time.Now().UTC().Add(-time.Hour)
+	require.NoError(t, memory.CreateImport(models.ImportJob{ID: "old", State: models.ImportRunning, Owner: "b", CreatedAt: created}))
+	require.NoError(t, memory.CreateImport(models.ImportJob{ID: "gone", State: models.ImportRunning, Owner: "c", CreatedAt: created, HeartbeatAt: &created}))
+
+	starting := NewSwiftService(memory)
+	starting.SetInstanceID("b")
+	starting.heartbeat = 10 * time.Millisecond
+	starting.importLease = 50 * time.Millisecond
+	time.Sleep(2 * starting.importLease)
+
+	n, err := starting.RecoverImports()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	for id, state := range map[string]models.ImportState{job.ID: models.ImportRunning, "old": models.ImportFailed, "gone": models.ImportFailed} {
+		stored, err := starting.GetImport(id)
+		require.NoError(t, err)
+		assert.Equal(t, state, stored.State, id)
+	}
+	_, err = starting.CancelImport(job.ID)
+	assert.ErrorIs(t, err, ErrImportNotRunning, "The job runs on the other instance")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watched := make(chan struct{})
+	go func() {
+		starting.WatchImports(ctx)
+		close(watched)
+	}()
+	time.Sleep(2 * starting.importLease)
+	cancel()
+	<-watched
+
+	stored, err := running.GetImport(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ImportRunning, stored.State, "A job with heartbeats is never abandoned")
+}
+
+// Tests that WatchImports fails a job once its instance stops sending heartbeats.
+func TestWatchImports(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	now := time.Now().UTC()
+	require.NoError(t, repo.CreateImport(models.ImportJob{ID: "crashed", State: models.ImportRunning, Owner: "a", CreatedAt: now, HeartbeatAt: &now}))
+
+	service := NewSwiftService(repo)
+	service.heartbeat = 10 * time.Millisecond
+	service.importLease = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go service.WatchImports(ctx)
+
+	require.Eventually(t, func() bool {
+		job, err := service.GetImport("crashed")
+		return err == nil && job.State == models.ImportFailed
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+)
+
+// maxJSONLineSize bounds one NDJSON line, far above any real record.
+const maxJSONLineSize = 1 << 20
+
+// jsonHeader names the fields of a JSON record, in the order they are put in
+// a row for the row parser and in the rejected rows report.
+var jsonHeader = []string{fieldSwiftCode, fieldBankName, fieldAddress, fieldISO2, fieldCountryName, fieldIsHeadquarter,
+	fieldCodeType, fieldTimeZone, fieldTown, fieldPostalCode}
+
+// jsonRecord has the shape of the single-record POST body.
+type jsonRecord struct {
+	Address       string `json:"address"`
+	BankName      string `json:"bankName"`
+	CountryISO2   string `json:"countryISO2"`
+	CountryName   string `json:"countryName"`
+	IsHeadquarter *bool  `json:"isHeadquarter"`
+	SwiftCode     string `json:"swiftCode"`
+	CodeType      string `json:"codeType"`
+	TimeZone      string `json:"timeZone"`
+	Town          string `json:"town"`
+	PostalCode    string `json:"postalCode"`
+}
+
+func (r jsonRecord) row() []string {
+	isHQ := ""
+	if r.IsHeadquarter != nil {
+		isHQ = strconv.FormatBool(*r.IsHeadquarter)
+	}
+	return []string{r.SwiftCode, r.BankName, r.Address, r.CountryISO2, r.CountryName, isHQ, r.CodeType, r.TimeZone, r.Town, r.PostalCode}
+}
+
+// ParseSwiftJSONWithReport reads either a JSON array of records or NDJSON, one
+// record per line, validating them like file rows. Rows in the report are the
+// array position or the line number. A malformed NDJSON line is rejected and
+// reading goes on; a syntax error inside an array fails the whole body.
+func ParseSwiftJSONWithReport(r io.Reader) ([]models.SwiftCodeData, *models.ImportReport, error) {
+	return collect(func(fn RecordFunc) (*models.ImportReport, error) {
+		return StreamSwiftJSON(r, fn)
+	})
+}
+
+// StreamSwiftJSON is ParseSwiftJSONWithReport passing the records to fn as
+// they are decoded.
+func StreamSwiftJSON(r io.Reader, fn RecordFunc) (*models.ImportReport, error) {
+	mapping := make(ColumnMapping, len(jsonHeader))
+	for _, field := range jsonHeader {
+		mapping[field] = []string{field}
+	}
+
+	report := &models.ImportReport{Rejections: []models.RowRejection{}}
+	parser, err := newRowParser(jsonHeader, ParseOptions{Columns: mapping}, report)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(r)
+	first, skippedLines, err := peekNonSpace(br)
+	if errors.Is(err, io.EOF) {
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	add := func(raw []byte, rowNum int) error {
+		var record jsonRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			report.TotalRows++
+			report.Reject(models.RowRejection{
+				Row:    rowNum,
+				Reason: fmt.Sprintf("malformed JSON: %v", err),
+				Values: []string{string(raw)},
+			})
+			return nil
+		}
+		if parsed, ok := parser.parse(record.row(), rowNum); ok {
+			return fn(parsed)
+		}
+		return nil
+	}
+
+	if first == '[' {
+		err = readJSONArray(br, add)
+	} else {
+		err = readNDJSON(br, skippedLines, add)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func readJSONArray(r io.Reader, add func(raw []byte, rowNum int) error) error {
+	dec := json.NewDecoder(r)
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	for i := 1; dec.More(); i++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+		if err := add(raw, i); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// readNDJSON numbers lines after the skipped ones already consumed.
+func readNDJSON(r io.Reader, skipped int, add func(raw []byte, rowNum int) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxJSONLineSize)
+	for line := skipped + 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		if err := add(raw, line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// peekNonSpace skips leading whitespace and returns the next byte unread,
+// with the number of line breaks skipped.
+func peekNonSpace(r *bufio.Reader) (byte, int, error) {
+	lines := 0
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, lines, err
+		}
+		switch b[0] {
+		case '\n':
+			lines++
+			fallthrough
+		case ' ', '\t', '\r':
+			if _, err := r.ReadByte(); err != nil {
+				return 0, lines, err
+			}
+		default:
+			return b[0], lines, nil
+		}
+	}
+}
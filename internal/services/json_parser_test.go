@@ -0,0 +1,65 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests a JSON array body with one valid and one invalid record.
+func TestParseSwiftJSON_Array(t *testing.T) {
+	body := `[
+		{"swiftCode": "BREXPLPWXXX", "bankName": "MBANK S.A.", "address": "UL. PROSTA 18", "countryISO2": "pl", "countryName": "Poland", "isHeadquarter": true},
+		{"swiftCode": "BREXPLPWLOD", "bankName": "MBANK S.A.", "countryISO2": "PL", "countryName": "POLAND", "isHeadquarter": true}
+	]`
+
+	records, report, err := ParseSwiftJSONWithReport(strings.NewReader(body))
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "BREXPLPWXXX", records[0].SwiftCode)
+	assert.Equal(t, "UL. PROSTA 18", records[0].Address)
+	assert.Equal(t, "PL", records[0].CountryISO2)
+	assert.Equal(t, "POLAND", records[0].CountryName)
+	assert.True(t, records[0].IsHeadquarter)
+
+	require.Equal(t, 1, report.Rejected)
+	assert.Equal(t, 2, report.Rejections[0].Row)
+	assert.Equal(t, "isHeadquarter", report.Rejections[0].Column)
+}
+
+// Tests that malformed NDJSON lines are rejected and the rest is still read.
+func TestParseSwiftJSON_NDJSON(t *testing.T) {
+	body := "\n" +
+		`{"swiftCode": "BREXPLPWXXX", "bankName": "MBANK S.A.", "countryISO2": "PL", "countryName": "POLAND"}` + "\n" +
+		`{"swiftCode": "BREXPLPW` + "\n" +
+		"\n" +
+		`{"swiftCode": 42}` + "\n" +
+		`{"swiftCode": "BREXPLPWXXX", "bankName": "MBANK S.A.", "countryISO2": "PL", "countryName": "POLAND"}` + "\n" +
+		`{"swiftCode": "BREXPLPWLOD", "bankName": "MBANK S.A.", "countryISO2": "PL", "countryName": "POLAND"}`
+
+	records, report, err := ParseSwiftJSONWithReport(strings.NewReader(body))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.False(t, records[1].IsHeadquarter)
+
+	assert.Equal(t, 5, report.TotalRows)
+	require.Equal(t, 3, report.Rejected)
+	assert.Equal(t, 3, report.Rejections[0].Row)
+	assert.Contains(t, report.Rejections[0].Reason, "malformed JSON")
+	assert.Equal(t, 5, report.Rejections[1].Row)
+	assert.Equal(t, 6, report.Rejections[2].Row)
+	assert.Contains(t, report.Rejections[2].Reason, "row 2")
+}
+
+// Tests that a syntax error inside an array fails the body, and an empty body is empty.
+func TestParseSwiftJSON_Errors(t *testing.T) {
+	_, _, err := ParseSwiftJSONWithReport(strings.NewReader(`[{"swiftCode": "BREXPLPWXXX"`))
+	assert.Error(t, err)
+
+	records, report, err := ParseSwiftJSONWithReport(strings.NewReader("  \n"))
+	require.NoError(t, err)
+	assert.Empty(t, records)
+	assert.Equal(t, 0, report.TotalRows)
+}
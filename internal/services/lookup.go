@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/Mekambee/Swift-Codes-Api/internal/repository"
+)
+
+const (
+	// DefaultMaxLookupCodes is the most codes LookupSwiftCodes accepts unless
+	// set otherwise with SetMaxLookupCodes.
+	DefaultMaxLookupCodes = 1000
+	// MaxLookupCodesLimit bounds the configurable size, and with it the
+	// number of queries, of a batch lookup.
+	MaxLookupCodesLimit = 10000
+)
+
+// ErrTooManyCodes is returned for a batch lookup over the configured size.
+var ErrTooManyCodes = errors.New("too many codes in one lookup")
+
+// CodeLookup is the result for one code of a batch lookup. Code is nil when
+// nothing matched. Branches is only set for a headquarter, when requested.
+type CodeLookup struct {
+	Match    models.CodeMatch
+	Code     *models.SwiftCodeData
+	Branches []models.SwiftCodeData
+}
+
+// SetMaxLookupCodes sets the most codes accepted by one LookupSwiftCodes call.
+func (s *SwiftService) SetMaxLookupCodes(n int) error {
+	if n < 1 || n > MaxLookupCodesLimit {
+		return fmt.Errorf("must be between 1 and %d, got %d", MaxLookupCodesLimit, n)
+	}
+	s.maxLookupCodes = n
+	return nil
+}
+
+// MaxLookupCodes returns the most codes accepted by one LookupSwiftCodes call.
+func (s *SwiftService) MaxLookupCodes() int {
+	return s.maxLookupCodes
+}
+
+// LookupSwiftCode finds the record of a code as received, trimmed and
+// upper-cased. An 8-character code that is not stored as such resolves to its
+// XXX headquarter; the returned match tells which form was found.
+func (s *SwiftService) LookupSwiftCode(swiftCode string) (*models.SwiftCodeData, models.CodeMatch, error) {
+	match := models.CodeMatch{Requested: swiftCode, Normalized: models.NormalizeSwiftCode(swiftCode), Form: models.MatchExact}
+	sc, err := s.repo.GetSwiftCode(match.Normalized)
+	if errors.Is(err, repository.ErrNotFound) && len(match.Normalized) == 8 {
+		match.Form = models.MatchBIC8
+		sc, err = s.repo.GetSwiftCode(match.Normalized + "XXX")
+	}
+	if err != nil {
+		return nil, match, err
+	}
+	match.Matched = sc.SwiftCode
+	return sc, match, nil
+}
+
+// LookupSwiftCodes looks up every code like LookupSwiftCode, reading all of
+// them with a single query, and returns the results in the order of codes.
+// With withBranches, headquarters come with their branches as given by
+// GetBranchesByHQ.
+func (s *SwiftService) LookupSwiftCodes(codes []string, withBranches bool) ([]CodeLookup, error) {
+	if len(codes) > s.maxLookupCodes {
+		return nil, fmt.Errorf("%w: got %d, at most %d are allowed", ErrTooManyCodes, len(codes), s.maxLookupCodes)
+	}
+
+	// Every code that can match a requested one, its headquarter or its
+	// branches shares its first 8 characters.
+	matches := make([]models.CodeMatch, len(codes))
+	var bic8s []string
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		normalized := models.NormalizeSwiftCode(code)
+		matches[i] = models.CodeMatch{Requested: code, Normalized: normalized, Form: models.MatchExact}
+		if prefix := bic8(normalized); !seen[prefix] {
+			seen[prefix] = true
+			bic8s = append(bic8s, prefix)
+		}
+	}
+	stored, err := s.repo.GetSwiftCodesByBIC8(bic8s)
+	if err != nil {
+		return nil, err
+	}
+	byCode := make(map[string]models.SwiftCodeData, len(stored))
+	byBIC8 := make(map[string][]models.SwiftCodeData)
+	for _, sc := range stored {
+		byCode[sc.SwiftCode] = sc
+		byBIC8[bic8(sc.SwiftCode)] = append(byBIC8[bic8(sc.SwiftCode)], sc)
+	}
+
+	results := make([]CodeLookup, len(codes))
+	for i, match := range matches {
+		sc, ok := byCode[match.Normalized]
+		if !ok && len(match.Normalized) == 8 {
+			match.Form = models.MatchBIC8
+			sc, ok = byCode[match.Normalized+"XXX"]
+		}
+		results[i].Match = match
+		if !ok {
+			continue
+		}
+		results[i].Match.Matched = sc.SwiftCode
+		results[i].Code = &sc
+		if withBranches && sc.IsHeadquarter {
+			branches := []models.SwiftCodeData{}
+			for _, other := range byBIC8[bic8(sc.SwiftCode)] {
+				if other.SwiftCode != sc.SwiftCode {
+					branches = append(branches, other)
+				}
+			}
+			results[i].Branches = branches
+		}
+	}
+	return results, nil
+}
+
+// bic8 returns the first 8 characters of code, or all of a shorter one.
+func bic8(code string) string {
+	if len(code) > 8 {
+		return code[:8]
+	}
+	return code
+}
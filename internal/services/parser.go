@@ -1,57 +1,353 @@
 package services
 
 import (
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/Mekambee/Swift-Codes-Api/internal/countries"
 	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/Mekambee/Swift-Codes-Api/internal/validation"
 	"github.com/xuri/excelize/v2"
 )
 
+// FileFormat is the kind of file an import is read from.
+type FileFormat string
+
+const (
+	FormatXLSX FileFormat = "xlsx"
+	FormatCSV  FileFormat = "csv"
+	FormatTSV  FileFormat = "tsv"
+)
+
+// ParseOptions tune how an import file is read.
+type ParseOptions struct {
+	// Columns maps fields to header names; nil means DefaultColumns.
+	Columns ColumnMapping
+	// Format overrides the format detected from the file extension.
+	Format FileFormat
+	// Delimiter and Encoding apply to CSV and TSV; zero values are detected.
+	Delimiter rune
+	Encoding  string
+}
+
+// DetectFormat tells the format from the content type if it is a known one,
+// otherwise from the extension of fileName. It returns "" when neither is known.
+func DetectFormat(fileName, contentType string) FileFormat {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch mediaType {
+		case "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+			return FormatXLSX
+		case "text/csv", "application/csv":
+			return FormatCSV
+		case "text/tab-separated-values":
+			return FormatTSV
+		}
+	}
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".xlsx":
+		return FormatXLSX
+	case ".csv":
+		return FormatCSV
+	case ".tsv", ".tab":
+		return FormatTSV
+	}
+	return ""
+}
+
+// RecordFunc receives every accepted record while a file is streamed. An
+// error stops the parsing and is returned by the Stream function as is.
+type RecordFunc func(Record) error
+
+// Record is an accepted row with the cells it was read from, so that a check
+// made later, like the one for duplicates, can still reject it.
+type Record struct {
+	models.SwiftCodeData
+	Values []string
+	// CodeColumn is the header of the SWIFT code column.
+	CodeColumn string
+}
+
+// duplicateOf rejects the record as a repeat of the code first seen in row first.
+func (r Record) duplicateOf(first int) models.RowRejection {
+	return models.RowRejection{
+		Row:    r.SourceRow,
+		Column: r.CodeColumn,
+		Reason: fmt.Sprintf("duplicate SWIFT code, first seen in row %d", first),
+		Values: r.Values,
+	}
+}
+
+// ParseSwiftFile parses an .xlsx, CSV or TSV file, chosen by opts.Format or
+// the file extension.
+func ParseSwiftFile(filePath string, opts ParseOptions) ([]models.SwiftCodeData, *models.ImportReport, error) {
+	return collect(func(fn RecordFunc) (*models.ImportReport, error) {
+		return StreamSwiftFile(filePath, opts, fn)
+	})
+}
+
+// StreamSwiftFile is ParseSwiftFile passing the records to fn one by one
+// instead of returning them.
+func StreamSwiftFile(filePath string, opts ParseOptions, fn RecordFunc) (*models.ImportReport, error) {
+	format := opts.Format
+	if format == "" {
+		format = DetectFormat(filePath, "")
+	}
+
+	switch format {
+	case FormatXLSX:
+		return StreamSwiftXLSX(filePath, opts, fn)
+	case FormatCSV, FormatTSV:
+		opts.Format = format
+		return StreamSwiftCSV(filePath, opts, fn)
+	}
+	return nil, fmt.Errorf("unsupported file type %q", filepath.Ext(filePath))
+}
+
+// collect gathers the records of a Stream function into a slice, rejecting
+// the repeats of a code. Imports leave that to the storage instead.
+func collect(stream func(RecordFunc) (*models.ImportReport, error)) ([]models.SwiftCodeData, *models.ImportReport, error) {
+	var result []models.SwiftCodeData
+	firstSeen := make(map[string]int)
+	duplicates := &models.ImportReport{}
+	report, err := stream(func(record Record) error {
+		if first, ok := firstSeen[record.SwiftCode]; ok {
+			duplicates.Reject(record.duplicateOf(first))
+			return nil
+		}
+		firstSeen[record.SwiftCode] = record.SourceRow
+		result = append(result, record.SwiftCodeData)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	report.RejectAccepted(duplicates)
+	return result, report, nil
+}
+
 func ParseSwiftXLSX(filePath string) ([]models.SwiftCodeData, error) {
+	result, _, err := ParseSwiftXLSXWithReport(filePath, ParseOptions{})
+	return result, err
+}
+
+// ParseSwiftXLSXWithReport parses the first sheet like ParseSwiftXLSX and
+// also reports every row it rejected, with the reason. Columns are located by
+// their header, so their order does not matter. A header row without one of
+// the required columns fails with a *MissingColumnsError.
+func ParseSwiftXLSXWithReport(filePath string, opts ParseOptions) ([]models.SwiftCodeData, *models.ImportReport, error) {
+	return collect(func(fn RecordFunc) (*models.ImportReport, error) {
+		return StreamSwiftXLSX(filePath, opts, fn)
+	})
+}
+
+// StreamSwiftXLSX reads the first sheet row by row with excelize's iterator,
+// so only the current row is held in memory.
+func StreamSwiftXLSX(filePath string, opts ParseOptions, fn RecordFunc) (*models.ImportReport, error) {
 	f, err := excelize.OpenFile(filePath)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	sheetName := f.GetSheetName(0)
-	rows, err := f.GetRows(sheetName)
+	rows, err := f.Rows(f.GetSheetName(0))
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	var result []models.SwiftCodeData
+	report := &models.ImportReport{
+		FileName:   filepath.Base(filePath),
+		Rejections: []models.RowRejection{},
+	}
+
+	var parser *rowParser
+	for rowNum := 1; rows.Next(); rowNum++ {
+		row, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
 
-	for i := 1; i < len(rows); i++ {
-		row := rows[i]
-		if len(row) < 8 {
+		if parser == nil {
+			if parser, err = newRowParser(row, opts, report); err != nil {
+				return nil, err
+			}
 			continue
 		}
 
-		iso2 := strings.ToUpper(row[0])
-		swift := row[1]
-		bankName := row[3]
-		address := row[4]
-		town := row[5]
-		countryName := strings.ToUpper(row[6])
-		fullAddress := address + ", " + town
+		if record, ok := parser.parse(row, rowNum); ok {
+			if err := fn(record); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := rows.Error(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// rowParser turns data rows into records once the header row is known,
+// recording every row in the report.
+type rowParser struct {
+	header  []string
+	columns map[string]int
+	report  *models.ImportReport
+}
+
+func newRowParser(header []string, opts ParseOptions, report *models.ImportReport) (*rowParser, error) {
+	mapping := opts.Columns
+	if mapping == nil {
+		mapping = DefaultColumns
+	}
+	columns, err := resolveColumns(header, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Header = header
+	return &rowParser{
+		header:  header,
+		columns: columns,
+		report:  report,
+	}, nil
+}
+
+// parse converts the row with the given 1-based sheet number. Blank rows are
+// ignored; invalid rows are added to the report and ok is false.
+func (p *rowParser) parse(row []string, rowNum int) (record Record, ok bool) {
+	if isBlankRow(row) {
+		return record, false
+	}
+	p.report.TotalRows++
+
+	data, rejection := p.convert(row)
+	values := append([]string(nil), row...)
+	if rejection != nil {
+		rejection.Row = rowNum
+		rejection.Values = values
+		p.report.Reject(*rejection)
+		return record, false
+	}
+
+	p.report.Accepted++
+	data.SourceRow = rowNum
+	return Record{SwiftCodeData: data, Values: values, CodeColumn: p.title(fieldSwiftCode)}, true
+}
+
+func (p *rowParser) convert(row []string) (models.SwiftCodeData, *models.RowRejection) {
+	iso2 := strings.ToUpper(p.value(row, fieldISO2))
+	swift := models.NormalizeSwiftCode(p.value(row, fieldSwiftCode))
+	bankName := p.value(row, fieldBankName)
+	address := p.value(row, fieldAddress)
+	town := models.NormalizeTown(p.value(row, fieldTown))
+	postalCode := models.NormalizePostalCode(p.value(row, fieldPostalCode))
+	codeType := models.NormalizeCodeType(p.value(row, fieldCodeType))
+	timeZone := p.value(row, fieldTimeZone)
+
+	if field, reason := validateRequired(iso2, swift, bankName); reason != "" {
+		return models.SwiftCodeData{}, &models.RowRejection{Column: p.title(field), Reason: reason}
+	}
+
+	if !models.ValidTimeZone(timeZone) {
+		return models.SwiftCodeData{}, &models.RowRejection{
+			Column: p.title(fieldTimeZone),
+			Reason: fmt.Sprintf("unknown time zone %q", timeZone),
+		}
+	}
 
-		isHQ := false
-		if strings.HasSuffix(strings.ToUpper(swift), "XXX") {
-			isHQ = true
+	isHQ := models.IsHeadquarterCode(swift)
+	if given := p.value(row, fieldIsHeadquarter); given != "" && given != strconv.FormatBool(isHQ) {
+		return models.SwiftCodeData{}, &models.RowRejection{
+			Column: p.title(fieldIsHeadquarter),
+			Reason: fmt.Sprintf("must be %t, headquarters are exactly the codes ending in XXX", isHQ),
 		}
+	}
 
-		data := models.SwiftCodeData{
-			SwiftCode:     swift,
-			BankName:      bankName,
-			Address:       fullAddress,
-			CountryISO2:   iso2,
-			CountryName:   countryName,
-			IsHeadquarter: isHQ,
+	return models.SwiftCodeData{
+		SwiftCode:     swift,
+		BankName:      bankName,
+		Address:       address,
+		Town:          town,
+		PostalCode:    postalCode,
+		CountryISO2:   iso2,
+		CountryName:   countries.Name(iso2, ""),
+		IsHeadquarter: isHQ,
+		CodeType:      codeType,
+		TimeZone:      timeZone,
+	}, nil
+}
+
+// value returns the trimmed cell of field, or "" when the column is absent
+// or the row is shorter (trailing empty cells are not stored in .xlsx rows).
+func (p *rowParser) value(row []string, field string) string {
+	idx, ok := p.columns[field]
+	if !ok || idx >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[idx])
+}
+
+// title returns the header of the column holding field, as written in the file.
+func (p *rowParser) title(field string) string {
+	return p.header[p.columns[field]]
+}
+
+// validateRequired returns the first invalid field and why, or an empty reason.
+// A SWIFT code whose country code differs from iso2 is reported on the
+// country column; any other structural failure on the SWIFT code column.
+// The country name is not checked, it is taken from the ISO 3166 reference.
+func validateRequired(iso2, swift, bankName string) (field, reason string) {
+	if swift == "" {
+		return fieldSwiftCode, "value is required"
+	}
+	var structural, mismatch []validation.Failure
+	for _, f := range validation.ValidateBIC(swift, iso2) {
+		if f.Check == validation.CheckCountryMatch {
+			mismatch = append(mismatch, f)
+		} else {
+			structural = append(structural, f)
 		}
+	}
+
+	switch {
+	case len(structural) > 0:
+		return fieldSwiftCode, validation.Messages(structural)
+	case len(iso2) != 2 || !isUpperLetters(iso2):
+		return fieldISO2, "must be a 2-letter country code"
+	case !isKnownCountry(iso2):
+		return fieldISO2, fmt.Sprintf("unknown ISO 3166 country code %q", iso2)
+	case len(mismatch) > 0:
+		return fieldISO2, validation.Messages(mismatch)
+	case bankName == "":
+		return fieldBankName, "value is required"
+	}
+	return "", ""
+}
+
+func isKnownCountry(iso2 string) bool {
+	_, ok := countries.Lookup(iso2)
+	return ok
+}
 
-		result = append(result, data)
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
 	}
+	return true
+}
 
-	return result, nil
+func isUpperLetters(s string) bool {
+	for _, r := range s {
+		if !(r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
 }
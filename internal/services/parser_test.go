@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Tests if the parser correctly reads a row without "XXX" (branch).
@@ -20,8 +21,8 @@ func TestParseSwiftXLSX_Basic(t *testing.T) {
 	assert.False(t, first.IsHeadquarter, "Should be branch if no 'XXX' suffix")
 	assert.Equal(t, "PL", first.CountryISO2, "ISO2 should be 'PL'")
 	assert.Equal(t, "POLAND", first.CountryName, "Country name should be 'POLAND'")
-	assert.Contains(t, first.Address, "ADDRESS1", "Address should contain 'ADDRESS1'")
-	assert.Contains(t, first.Address, "CITY1", "Address should contain 'CITY1'")
+	assert.Equal(t, "ADDRESS1", first.Address, "Address should be 'ADDRESS1'")
+	assert.Equal(t, "CITY1", first.Town, "Town should be kept apart as 'CITY1'")
 }
 
 // Tests if the parser recognizes "XXX" at the end as headquarter.
@@ -111,3 +112,90 @@ func TestParseSwiftXLSX_MixedCase(t *testing.T) {
 	assert.Equal(t, "PL", first.CountryISO2, "ISO2 should be forced to uppercase")
 	assert.Equal(t, "POLAND", first.CountryName, "Country name should be forced to uppercase")
 }
+
+// Tests that every invalid row is reported with its sheet row number, column and reason.
+func TestParseSwiftXLSXWithReport_InvalidRows(t *testing.T) {
+	testFile := filepath.Join("testdata", "test_invalid_rows.xlsx")
+
+	records, report, err := ParseSwiftXLSXWithReport(testFile, ParseOptions{})
+	assert.NoError(t, err, "Invalid rows should not fail the whole file")
+	assert.Len(t, records, 2, "Only the two valid rows should be returned")
+
+	assert.Equal(t, 6, report.TotalRows, "The blank row should not be counted")
+	assert.Equal(t, 2, report.Accepted)
+	assert.Equal(t, 4, report.Rejected)
+	assert.Len(t, report.Rejections, 4)
+
+	expected := []struct {
+		row    int
+		column string
+	}{
+		{3, "SWIFT CODE"},
+		{4, "NAME"},
+		{6, "SWIFT CODE"},
+		{7, "COUNTRY ISO2 CODE"},
+	}
+	for i, e := range expected {
+		assert.Equal(t, e.row, report.Rejections[i].Row)
+		assert.Equal(t, e.column, report.Rejections[i].Column)
+		assert.NotEmpty(t, report.Rejections[i].Reason)
+	}
+	assert.Contains(t, report.Rejections[2].Reason, "row 2", "Duplicates should point at the first occurrence")
+}
+
+// Tests that a short row is read by header position and rejected for the misplaced value.
+func TestParseSwiftXLSXWithReport_MissingColumns(t *testing.T) {
+	testFile := filepath.Join("testdata", "test_missing_cols.xlsx")
+
+	records, report, err := ParseSwiftXLSXWithReport(testFile, ParseOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, 3, report.TotalRows)
+	assert.Equal(t, 1, report.Rejected)
+	assert.Equal(t, 4, report.Rejections[0].Row)
+	assert.Equal(t, "SWIFT CODE", report.Rejections[0].Column)
+}
+
+// Tests that columns are found by header, in any order and under their aliases.
+func TestParseSwiftXLSXWithReport_ReorderedColumns(t *testing.T) {
+	testFile := filepath.Join("testdata", "test_reordered_cols.xlsx")
+
+	records, report, err := ParseSwiftXLSXWithReport(testFile, ParseOptions{})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, 0, report.Rejected)
+
+	hq := records[0]
+	assert.Equal(t, "ALBPPLPWXXX", hq.SwiftCode)
+	assert.Equal(t, "ALIOR BANK SPOLKA AKCYJNA", hq.BankName)
+	assert.Equal(t, "LOPUSZANSKA BUSINESS PARK LOPUSZANSKA 38 D", hq.Address)
+	assert.Equal(t, "WARSZAWA", hq.Town)
+	assert.Equal(t, "PL", hq.CountryISO2)
+	assert.Equal(t, "POLAND", hq.CountryName)
+	assert.True(t, hq.IsHeadquarter)
+	assert.False(t, records[1].IsHeadquarter)
+}
+
+// Tests that a file without a required column fails and names the column.
+func TestParseSwiftXLSXWithReport_MissingRequiredColumn(t *testing.T) {
+	testFile := filepath.Join("testdata", "test_custom_headers.xlsx")
+
+	_, _, err := ParseSwiftXLSXWithReport(testFile, ParseOptions{})
+	var missing *MissingColumnsError
+	require.ErrorAs(t, err, &missing)
+	assert.Equal(t, []string{"SWIFT CODE (swiftCode)", "NAME (bankName)"}, missing.Missing)
+}
+
+// Tests that a column mapping lets non-standard headers be read.
+func TestParseSwiftXLSXWithReport_ColumnMapping(t *testing.T) {
+	testFile := filepath.Join("testdata", "test_custom_headers.xlsx")
+
+	mapping, err := ParseColumnMapping(`{"swiftCode": "institution_bic", "bankName": ["LEGAL NAME"]}`)
+	require.NoError(t, err)
+
+	records, _, err := ParseSwiftXLSXWithReport(testFile, ParseOptions{Columns: DefaultColumns.Merge(mapping)})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "BREXPLPWXXX", records[0].SwiftCode)
+	assert.Equal(t, "MBANK S.A.", records[0].BankName)
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/xuri/excelize/v2"
+)
+
+// ErrReportNotFound is returned for unknown or expired report IDs.
+var ErrReportNotFound = errors.New("import report not found")
+
+// maxStoredReports bounds how many import reports are kept for download.
+const maxStoredReports = 100
+
+// reportStore keeps the most recent import reports in memory.
+type reportStore struct {
+	mu      sync.Mutex
+	order   []string
+	reports map[string]*models.ImportReport
+}
+
+func newReportStore() *reportStore {
+	return &reportStore{reports: make(map[string]*models.ImportReport)}
+}
+
+func (s *reportStore) add(report *models.ImportReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.order) >= maxStoredReports {
+		delete(s.reports, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.order = append(s.order, report.ID)
+	s.reports[report.ID] = report
+}
+
+func (s *reportStore) get(id string) (*models.ImportReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report, ok := s.reports[id]
+	if !ok {
+		return nil, ErrReportNotFound
+	}
+	return report, nil
+}
+
+func newReportID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// WriteRejectedRowsXLSX writes the rejected rows of report as a spreadsheet:
+// the original header and values plus an ERROR column with the row number,
+// the offending column and the reason.
+func WriteRejectedRowsXLSX(report *models.ImportReport, w io.Writer) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := f.GetSheetName(0)
+	width := len(report.Header)
+	for _, rejection := range report.Rejections {
+		if len(rejection.Values) > width {
+			width = len(rejection.Values)
+		}
+	}
+
+	header := make([]interface{}, width+1)
+	for i, title := range report.Header {
+		header[i] = title
+	}
+	header[width] = "ERROR"
+	if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+		return err
+	}
+
+	for i, rejection := range report.Rejections {
+		row := make([]interface{}, width+1)
+		for j, value := range rejection.Values {
+			row[j] = value
+		}
+		row[width] = describeRejection(rejection)
+
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+			return err
+		}
+	}
+
+	return f.Write(w)
+}
+
+func describeRejection(rejection models.RowRejection) string {
+	if rejection.Column == "" {
+		return fmt.Sprintf("row %d: %s", rejection.Row, rejection.Reason)
+	}
+	return fmt.Sprintf("row %d, %s: %s", rejection.Row, rejection.Column, rejection.Reason)
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+// Tests that the rejected rows spreadsheet keeps the original values and adds an ERROR column.
+func TestWriteRejectedRowsXLSX(t *testing.T) {
+	_, report, err := ParseSwiftXLSXWithReport(filepath.Join("testdata", "test_invalid_rows.xlsx"), ParseOptions{})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteRejectedRowsXLSX(report, &buf))
+
+	f, err := excelize.OpenReader(&buf)
+	require.NoError(t, err)
+	defer f.Close()
+
+	rows, err := f.GetRows(f.GetSheetName(0))
+	require.NoError(t, err)
+	require.Len(t, rows, 1+report.Rejected)
+
+	assert.Equal(t, "ERROR", rows[0][8])
+	assert.Equal(t, "AIPOPLP1X", rows[1][1])
+	assert.Contains(t, rows[1][8], "row 3, SWIFT CODE")
+}
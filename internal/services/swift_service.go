@@ -1,149 +1,499 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"sync"
+	"time"
 
-	"github.com/Mekambee/Swift-Codes-Api/internal/database"
+	"github.com/Mekambee/Swift-Codes-Api/internal/countries"
 	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/Mekambee/Swift-Codes-Api/internal/repository"
+	"github.com/Mekambee/Swift-Codes-Api/internal/validation"
 )
 
-func SaveSwiftCodes(data []models.SwiftCodeData) error {
-	tx, err := database.DB.Begin()
-	if err != nil {
-		return err
+type SwiftService struct {
+	repo    repository.SwiftCodeRepository
+	reports *reportStore
+	// columns extends DefaultColumns with the configured header aliases.
+	columns ColumnMapping
+	// maxLookupCodes is the most codes accepted by LookupSwiftCodes.
+	maxLookupCodes int
+	// readOnly is set when the storage cannot be written.
+	readOnly bool
+	// maxImportBytes is the largest import body accepted over HTTP.
+	maxImportBytes int64
+
+	// running holds the import jobs executed by this process.
+	runningMu sync.Mutex
+	running   map[string]*runningImport
+	// instanceID names this process as the owner of the jobs it runs.
+	instanceID string
+	// heartbeat is how often running jobs report, and importLease how long
+	// a job may go without a heartbeat before it counts as abandoned.
+	heartbeat, importLease time.Duration
+}
+
+func NewSwiftService(repo repository.SwiftCodeRepository) *SwiftService {
+	return &SwiftService{
+		repo:    repo,
+		reports: newReportStore(),
+		columns: DefaultColumns,
+		running: make(map[string]*runningImport),
+
+		maxLookupCodes: DefaultMaxLookupCodes,
+		maxImportBytes: DefaultMaxImportBytes,
+		instanceID:     newReportID(),
+		heartbeat:      ImportHeartbeat,
+		importLease:    ImportLease,
+	}
+}
+
+// SetColumnAliases adds header aliases, taking precedence over DefaultColumns,
+// to every file parsed through ParseFile.
+func (s *SwiftService) SetColumnAliases(aliases ColumnMapping) {
+	s.columns = DefaultColumns.Merge(aliases)
+}
+
+// SetReadOnly records that the storage is opened read-only, e.g. a
+// SQLite file with SQLITE_READ_ONLY, so that writes are refused up front.
+func (s *SwiftService) SetReadOnly(readOnly bool) {
+	s.readOnly = readOnly
+}
+
+// ReadOnly reports whether the storage is opened read-only.
+func (s *SwiftService) ReadOnly() bool {
+	return s.readOnly
+}
+
+// DefaultMaxImportBytes is the largest import body accepted unless set
+// otherwise with SetMaxImportBytes, well above a full directory file.
+const DefaultMaxImportBytes = 64 << 20
+
+// SetMaxImportBytes sets the largest file upload or bulk body accepted by
+// one import request.
+func (s *SwiftService) SetMaxImportBytes(n int64) error {
+	if n < 1 {
+		return fmt.Errorf("must be positive, got %d", n)
+	}
+	s.maxImportBytes = n
+	return nil
+}
+
+// MaxImportBytes returns the largest body accepted by one import request.
+func (s *SwiftService) MaxImportBytes() int64 {
+	return s.maxImportBytes
+}
+
+// ParseFile parses an uploaded .xlsx, CSV or TSV file. opts.Columns, e.g. sent
+// with the upload, take precedence over the configured aliases.
+func (s *SwiftService) ParseFile(filePath string, opts ParseOptions) ([]models.SwiftCodeData, *models.ImportReport, error) {
+	opts.Columns = s.columns.Merge(opts.Columns)
+	return ParseSwiftFile(filePath, opts)
+}
+
+// SaveSwiftCodes inserts the records with normalized codes and their canonical
+// country names, leaving already stored codes untouched. Nothing is stored if a record's
+// isHeadquarter flag contradicts its code.
+func (s *SwiftService) SaveSwiftCodes(data []models.SwiftCodeData) error {
+	named := make([]models.SwiftCodeData, len(data))
+	for i, sc := range data {
+		sc.SwiftCode = models.NormalizeSwiftCode(sc.SwiftCode)
+		if err := checkHeadquarter(sc); err != nil {
+			return err
+		}
+		named[i] = withCountryName(sc)
+	}
+	return s.repo.SaveSwiftCodes(named)
+}
+
+// ErrHeadquarterMismatch is returned for an isHeadquarter flag contradicting
+// the SWIFT code, see models.IsHeadquarterCode.
+var ErrHeadquarterMismatch = errors.New("isHeadquarter must be true exactly for codes ending in XXX")
+
+// HeadquarterFlag returns the isHeadquarter flag of code, derived from it.
+// A flag given by the caller must agree, otherwise ErrHeadquarterMismatch is
+// returned.
+func HeadquarterFlag(code string, given *bool) (bool, error) {
+	isHQ := models.IsHeadquarterCode(code)
+	if given != nil && *given != isHQ {
+		return isHQ, fmt.Errorf("%w, got %t for %s", ErrHeadquarterMismatch, *given, code)
+	}
+	return isHQ, nil
+}
+
+func checkHeadquarter(sc models.SwiftCodeData) error {
+	_, err := HeadquarterFlag(sc.SwiftCode, &sc.IsHeadquarter)
+	return err
+}
+
+// InvalidCodeError is returned for a record whose SWIFT code fails
+// validation.ValidateBIC, e.g. with a country code other than its countryISO2.
+type InvalidCodeError struct {
+	Failures []validation.Failure
+}
+
+func (e *InvalidCodeError) Error() string {
+	return "invalid SWIFT code: " + validation.Messages(e.Failures)
+}
+
+// checkUpdate checks a record about to replace the stored one: its code must
+// be valid for its country and its isHeadquarter flag agree with the code.
+func checkUpdate(sc models.SwiftCodeData) error {
+	if failures := validation.ValidateBIC(sc.SwiftCode, sc.CountryISO2); len(failures) > 0 {
+		return &InvalidCodeError{Failures: failures}
+	}
+	return checkHeadquarter(sc)
+}
+
+// withCountryName gives sc the ISO 3166 name of its country, keeping its own
+// name only for a country code missing from the reference.
+func withCountryName(sc models.SwiftCodeData) models.SwiftCodeData {
+	sc.CountryName = countries.Name(sc.CountryISO2, sc.CountryName)
+	return sc
+}
+
+// importBatchSize is how many parsed records are written to storage at once.
+const importBatchSize = 1000
+
+// ErrStorage marks an import that failed while writing, not while reading the input.
+var ErrStorage = errors.New("storage error")
+
+// ImportFile streams an .xlsx, CSV or TSV file into storage in batches, in
+// one import session, so memory use does not grow with the file. Like
+// ParseFile, opts.Columns take precedence over the configured aliases. If
+// the file turns out to be unreadable, nothing is stored.
+func (s *SwiftService) ImportFile(filePath string, opts ParseOptions, mode models.ImportMode) (models.ImportResult, *models.ImportReport, error) {
+	return s.importFile(context.Background(), "", filePath, opts, mode, nil)
+}
+
+func (s *SwiftService) importFile(ctx context.Context, importID, filePath string, opts ParseOptions, mode models.ImportMode, progress *importProgress) (models.ImportResult, *models.ImportReport, error) {
+	opts.Columns = s.columns.Merge(opts.Columns)
+	return s.importStream(ctx, importID, mode, progress, func(fn RecordFunc) (*models.ImportReport, error) {
+		return StreamSwiftFile(filePath, opts, fn)
+	})
+}
+
+// ImportJSON streams a JSON array or NDJSON body into storage like ImportFile
+// and records it in the import history. The returned job has finished; when
+// it failed, err says why.
+func (s *SwiftService) ImportJSON(r io.Reader, mode models.ImportMode, uploader string) (*models.ImportJob, error) {
+	job := s.newImportJob(models.ImportJob{Mode: mode, Uploader: uploader})
+	started := job.CreatedAt
+	job.State = models.ImportRunning
+	job.StartedAt = &started
+	if err := s.repo.CreateImport(job); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStorage, err)
+	}
+	defer s.keepAlive(job.ID)()
+
+	hash := sha256.New()
+	body := io.TeeReader(r, hash)
+	progress := &importProgress{}
+	result, report, err := s.importStream(context.Background(), job.ID, mode, progress, func(fn RecordFunc) (*models.ImportReport, error) {
+		return StreamSwiftJSON(body, fn)
+	})
+	// The checksum covers the whole body, also what follows the JSON array.
+	io.Copy(io.Discard, body)
+	job.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	s.finishImport(&job, progress, result, report, err)
+	return &job, err
+}
+
+// importStream writes the records of stream in batches within one session,
+// marking them as written by importID. Cancelling ctx stops it between
+// records and rolls everything back. progress, if not nil, is kept up to date.
+func (s *SwiftService) importStream(ctx context.Context, importID string, mode models.ImportMode, progress *importProgress, stream func(RecordFunc) (*models.ImportReport, error)) (models.ImportResult, *models.ImportReport, error) {
+	if progress == nil {
+		progress = &importProgress{}
 	}
 
-	stmt, err := tx.Prepare(`
-      INSERT INTO swift_codes (swift_code, bank_name, address, country_iso2, country_name, is_headquarter)
-      VALUES ($1, $2, $3, $4, $5, $6)
-      ON CONFLICT (swift_code) DO NOTHING
-    `)
+	session, err := s.repo.BeginImport(mode)
 	if err != nil {
-		tx.Rollback()
-		return err
+		return models.ImportResult{}, nil, fmt.Errorf("%w: %v", ErrStorage, err)
 	}
-	defer stmt.Close()
+	defer session.Rollback()
 
-	for _, sc := range data {
-		_, err = stmt.Exec(
-			sc.SwiftCode,
-			sc.BankName,
-			sc.Address,
-			sc.CountryISO2,
-			sc.CountryName,
-			sc.IsHeadquarter,
-		)
+	// The session turns away the repeats of a code; records keeps the rows
+	// of the batch to report them.
+	batch := make([]models.SwiftCodeData, 0, importBatchSize)
+	records := make([]Record, 0, importBatchSize)
+	duplicates := &models.ImportReport{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		repeated, err := session.Write(batch)
 		if err != nil {
-			tx.Rollback()
+			return fmt.Errorf("%w: %v", ErrStorage, err)
+		}
+		for _, d := range repeated {
+			duplicates.Reject(records[d.Index].duplicateOf(d.FirstRow))
+		}
+		progress.accepted.Add(-int64(len(repeated)))
+		progress.written.Add(int64(len(batch) - len(repeated)))
+		batch = batch[:0]
+		records = records[:0]
+		return nil
+	}
+
+	report, err := stream(func(record Record) error {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
+		progress.accepted.Add(1)
+		record.ImportID = importID
+		batch = append(batch, record.SwiftCodeData)
+		records = append(records, record)
+		if len(batch) < importBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return models.ImportResult{}, nil, err
+	}
+	if err := flush(); err != nil {
+		return models.ImportResult{}, nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return models.ImportResult{}, nil, err
 	}
 
-	return tx.Commit()
-}
-
-func GetSwiftCode(swiftCode string) (*models.SwiftCodeData, error) {
-	query := `
-      SELECT id, swift_code, bank_name, address, country_iso2, country_name, is_headquarter
-      FROM swift_codes
-      WHERE swift_code = $1
-      LIMIT 1
-    `
-	row := database.DB.QueryRow(query, swiftCode)
-	var sc models.SwiftCodeData
-	err := row.Scan(
-		&sc.ID,
-		&sc.SwiftCode,
-		&sc.BankName,
-		&sc.Address,
-		&sc.CountryISO2,
-		&sc.CountryName,
-		&sc.IsHeadquarter,
-	)
+	result, err := session.Commit()
 	if err != nil {
-		return nil, err
+		return models.ImportResult{}, nil, fmt.Errorf("%w: %v", ErrStorage, err)
 	}
-	return &sc, nil
+	report.RejectAccepted(duplicates)
+	return result, report, nil
 }
 
-func GetBranchesByHQ(swiftHQ string) ([]models.SwiftCodeData, error) {
-	base := swiftHQ[0:8]
-	query := `
-        SELECT id, swift_code, bank_name, address, country_iso2, country_name, is_headquarter
-        FROM swift_codes
-        WHERE LEFT(swift_code, 8) = $1 AND swift_code != $2
-    `
-	rows, err := database.DB.Query(query, base, swiftHQ)
+// PreviewImport compares data with the stored records and describes what
+// importing it would change in the given mode. Nothing is written.
+// For ImportReplace the diff shows the net effect, the same as for ImportSync.
+func (s *SwiftService) PreviewImport(data []models.SwiftCodeData, mode models.ImportMode) (*models.ImportDiff, error) {
+	codes := make([]string, len(data))
+	for i, sc := range data {
+		codes[i] = sc.SwiftCode
+	}
+	stored, err := s.repo.GetSwiftCodes(codes)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	result := []models.SwiftCodeData{}
-
-	for rows.Next() {
-		var sc models.SwiftCodeData
-		err := rows.Scan(
-			&sc.ID,
-			&sc.SwiftCode,
-			&sc.BankName,
-			&sc.Address,
-			&sc.CountryISO2,
-			&sc.CountryName,
-			&sc.IsHeadquarter,
-		)
+	storedByCode := make(map[string]models.SwiftCodeData, len(stored))
+	for _, sc := range stored {
+		storedByCode[sc.SwiftCode] = sc
+	}
+
+	diff := &models.ImportDiff{
+		Added:   []models.SwiftCodeData{},
+		Changed: []models.SwiftCodeChange{},
+		Skipped: []models.SwiftCodeChange{},
+		Removed: []string{},
+	}
+	inFile := make(map[string]struct{}, len(data))
+	for _, sc := range data {
+		inFile[sc.SwiftCode] = struct{}{}
+
+		current, ok := storedByCode[sc.SwiftCode]
+		if !ok {
+			diff.Added = append(diff.Added, sc)
+			diff.Summary.Inserted++
+			continue
+		}
+		changes := current.FieldChanges(sc)
+		switch {
+		case len(changes) == 0:
+			diff.Summary.Unchanged++
+		case mode == models.ImportInsert:
+			diff.Skipped = append(diff.Skipped, models.SwiftCodeChange{SwiftCode: sc.SwiftCode, Fields: changes})
+			diff.Summary.Skipped++
+		default:
+			diff.Changed = append(diff.Changed, models.SwiftCodeChange{SwiftCode: sc.SwiftCode, Fields: changes})
+			diff.Summary.Updated++
+		}
+	}
+
+	if mode == models.ImportSync || mode == models.ImportReplace {
+		all, err := s.repo.ListCodes()
 		if err != nil {
 			return nil, err
 		}
-		result = append(result, sc)
+		for _, code := range all {
+			if _, ok := inFile[code]; !ok {
+				diff.Removed = append(diff.Removed, code)
+				diff.Summary.Deleted++
+			}
+		}
+	}
+
+	return diff, nil
+}
+
+// StoreReport assigns report an ID and keeps it for later download.
+func (s *SwiftService) StoreReport(report *models.ImportReport) {
+	report.ID = newReportID()
+	s.reports.add(report)
+}
+
+// GetReport returns a stored import report, or the report of a finished
+// import job with that ID, or ErrReportNotFound.
+func (s *SwiftService) GetReport(id string) (*models.ImportReport, error) {
+	report, err := s.reports.get(id)
+	if err == nil {
+		return report, nil
+	}
+
+	job, jobErr := s.repo.GetImport(id)
+	if errors.Is(jobErr, repository.ErrNotFound) || (jobErr == nil && job.Report == nil) {
+		return nil, err
+	}
+	if jobErr != nil {
+		return nil, jobErr
+	}
+	return job.Report, nil
+}
+
+func (s *SwiftService) GetSwiftCode(swiftCode string) (*models.SwiftCodeData, error) {
+	return s.repo.GetSwiftCode(models.NormalizeSwiftCode(swiftCode))
+}
+
+func (s *SwiftService) GetBranchesByHQ(swiftHQ string) ([]models.SwiftCodeData, error) {
+	swiftHQ = models.NormalizeSwiftCode(swiftHQ)
+	if len(swiftHQ) < 8 {
+		return nil, fmt.Errorf("swift code %q is too short to have branches", swiftHQ)
 	}
-	return result, nil
+	return s.repo.GetBranchesByHQ(swiftHQ)
+}
+
+// SearchSwiftCodes returns the page of records matching q and the total
+// number of matching records.
+func (s *SwiftService) SearchSwiftCodes(q repository.SearchQuery) ([]models.SwiftCodeData, int, error) {
+	return s.repo.SearchSwiftCodes(q)
+}
+
+// FuzzySearch ranks the records by how well their bank name and address
+// match q.Text, ignoring case and diacritics.
+func (s *SwiftService) FuzzySearch(q repository.FuzzyQuery) ([]models.ScoredSwiftCode, error) {
+	return s.repo.FuzzySearch(q)
+}
+
+func (s *SwiftService) GetSwiftByCountryISO2(iso2 string, filter repository.CountryFilter, page repository.CountryPage) ([]models.SwiftCodeData, error) {
+	return s.repo.GetSwiftByCountryISO2(iso2, filter, page)
 }
 
-func GetSwiftByCountryISO2(iso2 string) ([]models.SwiftCodeData, error) {
-	query := `
-      SELECT id, swift_code, bank_name, address, country_iso2, country_name, is_headquarter
-      FROM swift_codes
-      WHERE country_iso2 = $1
-    `
-	rows, err := database.DB.Query(query, iso2)
+// CountryTree returns every code of a country, with branches nested under
+// their headquarter as GetBranchesByHQ finds them, and the branches without a
+// stored headquarter as orphans. It returns repository.ErrNotFound for a
+// country without codes.
+func (s *SwiftService) CountryTree(iso2 string) (*models.CountryTree, error) {
+	records, err := s.repo.GetSwiftByCountryISO2(iso2, repository.CountryFilter{}, repository.CountryPage{})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var result []models.SwiftCodeData
-	for rows.Next() {
-		var sc models.SwiftCodeData
-		err := rows.Scan(
-			&sc.ID,
-			&sc.SwiftCode,
-			&sc.BankName,
-			&sc.Address,
-			&sc.CountryISO2,
-			&sc.CountryName,
-			&sc.IsHeadquarter,
-		)
-		if err != nil {
-			return nil, err
+	if len(records) == 0 {
+		return nil, repository.ErrNotFound
+	}
+
+	tree := &models.CountryTree{
+		CountryISO2:  iso2,
+		CountryName:  countries.Name(iso2, records[0].CountryName),
+		Headquarters: []models.HeadquarterBranches{},
+		Orphans:      []models.SwiftCodeData{},
+	}
+	// Records come ordered by code, so the headquarters and each one's
+	// branches stay in that order.
+	headquarters := make(map[string]int)
+	for _, sc := range records {
+		if sc.IsHeadquarter {
+			headquarters[bic8(sc.SwiftCode)] = len(tree.Headquarters)
+			tree.Headquarters = append(tree.Headquarters, models.HeadquarterBranches{
+				SwiftCodeData: sc,
+				Branches:      []models.SwiftCodeData{},
+			})
+		}
+	}
+	for _, sc := range records {
+		if sc.IsHeadquarter {
+			continue
+		}
+		if i, ok := headquarters[bic8(sc.SwiftCode)]; ok {
+			tree.Headquarters[i].Branches = append(tree.Headquarters[i].Branches, sc)
+		} else {
+			tree.Orphans = append(tree.Orphans, sc)
 		}
-		result = append(result, sc)
 	}
-	return result, nil
+	return tree, nil
+}
+
+// GetCountryHeadquarters returns a page of a country's headquarters, each
+// with its number of branches.
+func (s *SwiftService) GetCountryHeadquarters(iso2 string, filter repository.CountryFilter, page repository.CountryPage) ([]models.Headquarter, error) {
+	return s.repo.GetCountryHeadquarters(iso2, filter, page)
 }
 
-func DeleteSwiftCode(swiftCode, bankName, iso2 string) error {
-	query := `
-      DELETE FROM swift_codes
-      WHERE swift_code = $1 AND bank_name = $2 AND country_iso2 = $3
-    `
-	res, err := database.DB.Exec(query, swiftCode, bankName, iso2)
+// ListCountries returns every country with stored codes and how many of them
+// are headquarters and branches, named after the ISO 3166 reference.
+func (s *SwiftService) ListCountries() ([]models.CountrySummary, error) {
+	summaries, err := s.repo.CountCountries()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("no matching record found")
+	for i := range summaries {
+		summaries[i].CountryName = countries.Name(summaries[i].CountryISO2, summaries[i].CountryName)
 	}
-	return nil
+	return summaries, nil
+}
+
+// RepairHeadquarters returns the stored records whose isHeadquarter flag
+// contradicts their code and, unless dryRun, sets the flag from the code.
+func (s *SwiftService) RepairHeadquarters(dryRun bool) ([]models.SwiftCodeData, error) {
+	mismatches, err := s.repo.HeadquarterMismatches()
+	if err != nil || dryRun {
+		return mismatches, err
+	}
+	if _, err := s.repo.RepairHeadquarters(); err != nil {
+		return nil, err
+	}
+	return mismatches, nil
+}
+
+// UpdateSwiftCode replaces the stored fields of sc.SwiftCode, with the
+// canonical country name. A non-zero expectedVersion must match the stored
+// version, the code must be valid for the record's country (else an
+// *InvalidCodeError is returned) and the isHeadquarter flag match the code.
+func (s *SwiftService) UpdateSwiftCode(sc models.SwiftCodeData, expectedVersion int64) (*models.SwiftCodeData, error) {
+	sc.SwiftCode = models.NormalizeSwiftCode(sc.SwiftCode)
+	if err := checkUpdate(sc); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateSwiftCode(withCountryName(sc), expectedVersion)
+}
+
+// PatchSwiftCode changes only the fields set in patch. The write is made
+// conditional on the version that was read, so a concurrent update in
+// between is reported as a conflict instead of being overwritten. The patched
+// record is checked as in UpdateSwiftCode.
+func (s *SwiftService) PatchSwiftCode(swiftCode string, patch models.SwiftCodePatch, expectedVersion int64) (*models.SwiftCodeData, error) {
+	current, err := s.repo.GetSwiftCode(models.NormalizeSwiftCode(swiftCode))
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion != 0 && current.Version != expectedVersion {
+		return nil, repository.ErrVersionConflict
+	}
+	patch.Apply(current)
+	if err := checkUpdate(*current); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateSwiftCode(withCountryName(*current), current.Version)
+}
+
+func (s *SwiftService) DeleteSwiftCode(swiftCode, bankName, iso2 string) error {
+	return s.repo.DeleteSwiftCode(models.NormalizeSwiftCode(swiftCode), bankName, iso2)
 }
@@ -1,20 +1,18 @@
 package services
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/Mekambee/Swift-Codes-Api/internal/database"
 	"github.com/Mekambee/Swift-Codes-Api/internal/models"
+	"github.com/Mekambee/Swift-Codes-Api/internal/repository"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestSwiftService_Basic(t *testing.T) {
-	err := database.ConnectAndMigrate("localhost", "myuser", "mysecretpassword", "swiftdb", "5432")
-	assert.NoError(t, err)
-	defer database.DB.Close()
-
-	database.DB.Exec("TRUNCATE swift_codes RESTART IDENTITY")
-
+// runBasicFlow saves an HQ with one branch, reads them back and deletes the HQ.
+func runBasicFlow(t *testing.T, service *SwiftService) {
 	records := []models.SwiftCodeData{
 		{
 			SwiftCode:     "TESTPLW1XXX",
@@ -33,21 +31,239 @@ func TestSwiftService_Basic(t *testing.T) {
 			IsHeadquarter: false,
 		},
 	}
-	err = SaveSwiftCodes(records)
+	err := service.SaveSwiftCodes(records)
 	assert.NoError(t, err, "Should save without error")
 
-	sc, err := GetSwiftCode("TESTPLW1XXX")
+	sc, err := service.GetSwiftCode("TESTPLW1XXX")
 	assert.NoError(t, err)
 	assert.Equal(t, "TESTPLW1XXX", sc.SwiftCode)
 	assert.True(t, sc.IsHeadquarter)
 
-	branches, err := GetBranchesByHQ("TESTPLW1XXX")
+	branches, err := service.GetBranchesByHQ("TESTPLW1XXX")
 	assert.NoError(t, err)
 	assert.Len(t, branches, 1, "Should find one branch matching first 8 chars")
 
-	err = DeleteSwiftCode("TESTPLW1XXX", "TEST BANK", "PL")
+	err = service.DeleteSwiftCode("TESTPLW1XXX", "TEST BANK", "PL")
 	assert.NoError(t, err, "Should delete HQ record")
 
-	_, err = GetSwiftCode("TESTPLW1XXX")
-	assert.Error(t, err, "Should not find the HQ after deletion")
+	_, err = service.GetSwiftCode("TESTPLW1XXX")
+	assert.ErrorIs(t, err, repository.ErrNotFound, "Should not find the HQ after deletion")
+}
+
+func TestSwiftService_Basic(t *testing.T) {
+	db, err := database.ConnectAndMigrate("localhost", "myuser", "mysecretpassword", "swiftdb", "5432")
+	require.NoError(t, err)
+	defer db.Close()
+
+	db.Exec("TRUNCATE swift_codes RESTART IDENTITY")
+
+	runBasicFlow(t, NewSwiftService(repository.NewPostgresRepository(db)))
+}
+
+func TestSwiftService_Memory(t *testing.T) {
+	runBasicFlow(t, NewSwiftService(repository.NewMemoryRepository()))
+}
+
+func TestSwiftService_SQLite(t *testing.T) {
+	db, err := database.ConnectAndMigrateSQLite(filepath.Join(t.TempDir(), "swift.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	runBasicFlow(t, NewSwiftService(repository.NewSQLiteRepository(db)))
+}
+
+// Tests that deleting with a mismatching bank name is reported as not found.
+func TestSwiftService_DeleteMismatch(t *testing.T) {
+	service := NewSwiftService(repository.NewMemoryRepository())
+	err := service.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1XXX", BankName: "TEST BANK", CountryISO2: "PL", CountryName: "POLAND", IsHeadquarter: true},
+	})
+	assert.NoError(t, err)
+
+	err = service.DeleteSwiftCode("TESTPLW1XXX", "OTHER BANK", "PL")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	_, err = service.GetSwiftCode("TESTPLW1XXX")
+	assert.NoError(t, err, "Record should still exist")
+}
+
+// Tests that writes whose isHeadquarter flag contradicts the code are rejected.
+func TestSwiftService_HeadquarterRule(t *testing.T) {
+	service := NewSwiftService(repository.NewMemoryRepository())
+
+	err := service.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1ABC", BankName: "TEST BANK", CountryISO2: "PL", IsHeadquarter: true},
+	})
+	assert.ErrorIs(t, err, ErrHeadquarterMismatch)
+
+	err = service.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1XXX", BankName: "TEST BANK", CountryISO2: "PL", IsHeadquarter: true},
+	})
+	require.NoError(t, err)
+	_, err = service.UpdateSwiftCode(models.SwiftCodeData{SwiftCode: "TESTPLW1XXX", BankName: "TEST BANK", CountryISO2: "PL"}, 0)
+	assert.ErrorIs(t, err, ErrHeadquarterMismatch)
+	branch := false
+	_, err = service.PatchSwiftCode("TESTPLW1XXX", models.SwiftCodePatch{IsHeadquarter: &branch}, 0)
+	assert.ErrorIs(t, err, ErrHeadquarterMismatch)
+
+	isHQ, err := HeadquarterFlag("TESTPLW1xxx", nil)
+	assert.NoError(t, err)
+	assert.True(t, isHQ, "A missing flag should be derived from the code")
+}
+
+// Tests that lookups ignore case and spaces and that an 8-character code resolves to its headquarter.
+func TestSwiftService_LookupSwiftCode(t *testing.T) {
+	service := NewSwiftService(repository.NewMemoryRepository())
+	require.NoError(t, service.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: " testplw1xxx", BankName: "TEST BANK", CountryISO2: "PL", IsHeadquarter: true},
+		{SwiftCode: "OTHRPLW1", BankName: "OTHER BANK", CountryISO2: "PL"},
+	}))
+
+	sc, match, err := service.LookupSwiftCode(" testPLW1XXX ")
+	require.NoError(t, err)
+	assert.Equal(t, "TESTPLW1XXX", sc.SwiftCode)
+	assert.Equal(t, models.CodeMatch{Requested: " testPLW1XXX ", Normalized: "TESTPLW1XXX", Matched: "TESTPLW1XXX", Form: models.MatchExact}, match)
+
+	sc, match, err = service.LookupSwiftCode("testplw1")
+	require.NoError(t, err)
+	assert.Equal(t, "TESTPLW1XXX", sc.SwiftCode)
+	assert.Equal(t, models.MatchBIC8, match.Form)
+
+	_, match, err = service.LookupSwiftCode("othrplw1")
+	require.NoError(t, err)
+	assert.Equal(t, models.MatchExact, match.Form, "An 8-character code stored as such should match directly")
+
+	_, _, err = service.LookupSwiftCode("NOPEPLW1")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+// Tests a batch lookup: results in request order, BIC8 resolution, branches on request and the size limit.
+func TestSwiftService_LookupSwiftCodes(t *testing.T) {
+	service := NewSwiftService(repository.NewMemoryRepository())
+	require.NoError(t, service.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1XXX", BankName: "TEST BANK", CountryISO2: "PL", IsHeadquarter: true},
+		{SwiftCode: "TESTPLW1ABC", BankName: "TEST BANK", CountryISO2: "PL"},
+		{SwiftCode: "TESTDEFFXXX", BankName: "TEST BANK DE", CountryISO2: "DE", IsHeadquarter: true},
+	}))
+
+	results, err := service.LookupSwiftCodes([]string{"testplw1abc", "NOPEPLW1XXX", " TESTPLW1", "TESTDEFFXXX"}, true)
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+
+	assert.Equal(t, "TESTPLW1ABC", results[0].Match.Matched)
+	assert.Nil(t, results[0].Branches, "Branches are only listed for headquarters")
+	assert.Nil(t, results[1].Code)
+	assert.Equal(t, "NOPEPLW1XXX", results[1].Match.Requested)
+	assert.Equal(t, models.MatchBIC8, results[2].Match.Form)
+	require.NotNil(t, results[2].Code)
+	assert.Equal(t, "TESTPLW1XXX", results[2].Code.SwiftCode)
+	require.Len(t, results[2].Branches, 1)
+	assert.Equal(t, "TESTPLW1ABC", results[2].Branches[0].SwiftCode)
+	assert.NotNil(t, results[3].Branches, "A headquarter without branches has an empty list")
+	assert.Empty(t, results[3].Branches)
+
+	results, err = service.LookupSwiftCodes([]string{"TESTPLW1XXX"}, false)
+	require.NoError(t, err)
+	assert.Nil(t, results[0].Branches)
+
+	require.NoError(t, service.SetMaxLookupCodes(2))
+	_, err = service.LookupSwiftCodes([]string{"A", "B", "C"}, false)
+	assert.ErrorIs(t, err, ErrTooManyCodes)
+	assert.Error(t, service.SetMaxLookupCodes(0))
+	assert.Error(t, service.SetMaxLookupCodes(MaxLookupCodesLimit+1))
+}
+
+// Tests that a country tree nests branches under their headquarter and keeps branches without one apart.
+func TestSwiftService_CountryTree(t *testing.T) {
+	service := NewSwiftService(repository.NewMemoryRepository())
+	require.NoError(t, service.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "BBBBPLPW123", BankName: "B", CountryISO2: "PL"},
+		{SwiftCode: "AAAAPLPWXXX", BankName: "A", CountryISO2: "PL", IsHeadquarter: true},
+		{SwiftCode: "AAAAPLPW456", BankName: "A", CountryISO2: "PL"},
+		{SwiftCode: "CCCCPLPWXXX", BankName: "C", CountryISO2: "PL", IsHeadquarter: true},
+		{SwiftCode: "AAAAPLPW123", BankName: "A", CountryISO2: "PL"},
+		{SwiftCode: "DDDDDEFFXXX", BankName: "D", CountryISO2: "DE", IsHeadquarter: true},
+	}))
+
+	tree, err := service.CountryTree("PL")
+	require.NoError(t, err)
+	assert.Equal(t, "POLAND", tree.CountryName)
+	require.Len(t, tree.Headquarters, 2)
+	assert.Equal(t, "AAAAPLPWXXX", tree.Headquarters[0].SwiftCode)
+	require.Len(t, tree.Headquarters[0].Branches, 2)
+	assert.Equal(t, "AAAAPLPW123", tree.Headquarters[0].Branches[0].SwiftCode)
+	assert.Equal(t, "AAAAPLPW456", tree.Headquarters[0].Branches[1].SwiftCode)
+	assert.Equal(t, "CCCCPLPWXXX", tree.Headquarters[1].SwiftCode)
+	assert.Empty(t, tree.Headquarters[1].Branches)
+	require.Len(t, tree.Orphans, 1)
+	assert.Equal(t, "BBBBPLPW123", tree.Orphans[0].SwiftCode)
+
+	_, err = service.CountryTree("US")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+// Tests that a dry run only lists inconsistent records and a repair fixes them.
+func TestSwiftService_RepairHeadquarters(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	require.NoError(t, repo.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1XXX", BankName: "TEST BANK", CountryISO2: "PL"},
+		{SwiftCode: "TESTPLW1ABC", BankName: "TEST BANK", CountryISO2: "PL"},
+	}))
+	service := NewSwiftService(repo)
+
+	found, err := service.RepairHeadquarters(true)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "TESTPLW1XXX", found[0].SwiftCode)
+	sc, err := repo.GetSwiftCode("TESTPLW1XXX")
+	require.NoError(t, err)
+	assert.False(t, sc.IsHeadquarter, "A dry run must not change anything")
+
+	found, err = service.RepairHeadquarters(false)
+	require.NoError(t, err)
+	assert.Len(t, found, 1)
+	sc, err = repo.GetSwiftCode("TESTPLW1XXX")
+	require.NoError(t, err)
+	assert.True(t, sc.IsHeadquarter)
+
+	found, err = service.RepairHeadquarters(true)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+// Tests that a preview lists added, changed and removed codes without writing anything.
+func TestSwiftService_PreviewImport(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	service := NewSwiftService(repo)
+	err := service.SaveSwiftCodes([]models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1XXX", BankName: "TEST BANK", Address: "OLD", CountryISO2: "PL", CountryName: "POLAND", IsHeadquarter: true},
+		{SwiftCode: "TESTPLW1ABC", BankName: "TEST BANK", Address: "BRANCH", CountryISO2: "PL", CountryName: "POLAND"},
+		{SwiftCode: "TESTDEFFXXX", BankName: "GONE BANK", Address: "HQ", CountryISO2: "DE", CountryName: "GERMANY", IsHeadquarter: true},
+	})
+	assert.NoError(t, err)
+
+	file := []models.SwiftCodeData{
+		{SwiftCode: "TESTPLW1XXX", BankName: "TEST BANK", Address: "NEW", CountryISO2: "PL", CountryName: "POLAND", IsHeadquarter: true},
+		{SwiftCode: "TESTPLW1ABC", BankName: "TEST BANK", Address: "BRANCH", CountryISO2: "PL", CountryName: "POLAND"},
+		{SwiftCode: "TESTATWWXXX", BankName: "NEW BANK", Address: "HQ", CountryISO2: "AT", CountryName: "AUSTRIA", IsHeadquarter: true},
+	}
+
+	diff, err := service.PreviewImport(file, models.ImportSync)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportResult{Inserted: 1, Updated: 1, Unchanged: 1, Deleted: 1}, diff.Summary)
+	assert.Equal(t, "TESTATWWXXX", diff.Added[0].SwiftCode)
+	assert.Equal(t, []string{"TESTDEFFXXX"}, diff.Removed)
+	assert.Equal(t, "TESTPLW1XXX", diff.Changed[0].SwiftCode)
+	assert.Equal(t, []models.FieldChange{{Field: "address", Old: "OLD", New: "NEW"}}, diff.Changed[0].Fields)
+
+	diff, err = service.PreviewImport(file, models.ImportInsert)
+	assert.NoError(t, err)
+	assert.Empty(t, diff.Changed)
+	assert.Len(t, diff.Skipped, 1, "Insert mode keeps changed codes as they are")
+	assert.Empty(t, diff.Removed)
+
+	sc, _ := service.GetSwiftCode("TESTPLW1XXX")
+	assert.Equal(t, "OLD", sc.Address, "A preview must not write")
+	_, err = service.GetSwiftCode("TESTATWWXXX")
+	assert.ErrorIs(t, err, repository.ErrNotFound, "A preview must not write")
 }
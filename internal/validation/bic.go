@@ -0,0 +1,98 @@
+// Package validation checks SWIFT codes (BICs, ISO 9362) before they are stored.
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Mekambee/Swift-Codes-Api/internal/countries"
+)
+
+// Names of the checks made by ValidateBIC, as reported in a Failure.
+const (
+	CheckLength       = "length"
+	CheckInstitution  = "institution"
+	CheckCountry      = "country"
+	CheckLocation     = "location"
+	CheckBranch       = "branch"
+	CheckCountryMatch = "countryMatch"
+)
+
+// Failure is one check a SWIFT code did not pass.
+type Failure struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// ValidateBIC checks the structure of a SWIFT code: a 4-letter institution
+// code, an ISO 3166 country code, a 2-character location code and an
+// optional 3-character branch code, 8 or 11 characters in total. When
+// countryISO2 is not empty, the country code must also be countryISO2.
+// Letters are compared ignoring case. It returns every failed check, in
+// that order, or nil for a valid code.
+//
+// A part missing from a code that is too short only fails the length check,
+// and the branch code is only checked in an 11-character code.
+func ValidateBIC(code, countryISO2 string) []Failure {
+	code = strings.ToUpper(code)
+	var failures []Failure
+	fail := func(check, format string, args ...interface{}) {
+		failures = append(failures, Failure{Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(code) != 8 && len(code) != 11 {
+		fail(CheckLength, "must be 8 or 11 characters, got %d", len(code))
+	}
+	if institution, ok := part(code, 0, 4); ok && !isLetters(institution) {
+		fail(CheckInstitution, "institution code %q (characters 1-4) must be 4 letters", institution)
+	}
+	country, hasCountry := part(code, 4, 6)
+	if _, known := countries.Lookup(country); hasCountry && !known {
+		fail(CheckCountry, "country code %q (characters 5-6) is not an ISO 3166 country code", country)
+	}
+	if location, ok := part(code, 6, 8); ok && !isAlphanumeric(location) {
+		fail(CheckLocation, "location code %q (characters 7-8) must be 2 letters or digits", location)
+	}
+	if branch, ok := part(code, 8, 11); ok && len(code) == 11 && !isAlphanumeric(branch) {
+		fail(CheckBranch, "branch code %q (characters 9-11) must be 3 letters or digits", branch)
+	}
+	if iso2 := strings.ToUpper(countryISO2); hasCountry && iso2 != "" && country != iso2 {
+		fail(CheckCountryMatch, "country code %q (characters 5-6) does not match countryISO2 %q", country, iso2)
+	}
+	return failures
+}
+
+// Messages joins the messages of failures, for a single error string.
+func Messages(failures []Failure) string {
+	messages := make([]string, len(failures))
+	for i, f := range failures {
+		messages[i] = f.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// part returns code[from:to], or false when code is too short to hold it.
+func part(code string, from, to int) (string, bool) {
+	if len(code) < to {
+		return "", false
+	}
+	return code[from:to], true
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if !(r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(s string) bool {
+	for _, r := range s {
+		if !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
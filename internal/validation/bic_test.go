@@ -0,0 +1,60 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// checks returns the names of the failed checks.
+func checks(failures []Failure) []string {
+	var names []string
+	for _, f := range failures {
+		names = append(names, f.Check)
+	}
+	return names
+}
+
+// Tests valid 8 and 11 character codes, in any case and with or without a country to match.
+func TestValidateBIC_Valid(t *testing.T) {
+	assert.Nil(t, ValidateBIC("BREXPLPWXXX", "PL"))
+	assert.Nil(t, ValidateBIC("BREXPLPW", ""))
+	assert.Nil(t, ValidateBIC("brexplpw123", "pl"))
+	assert.Nil(t, ValidateBIC("ALBPXKP1", "XK"), "SWIFT uses XK for Kosovo")
+}
+
+// Tests that every failed check is reported.
+func TestValidateBIC_Failures(t *testing.T) {
+	tests := []struct {
+		code, iso2 string
+		failed     []string
+	}{
+		{"", "", []string{CheckLength}},
+		{"BREXPL", "PL", []string{CheckLength}},
+		{"AIPOPLP1X", "PL", []string{CheckLength}},
+		{"BREXPLPWXXXX", "", []string{CheckLength}},
+		{"B1EXPLPWXXX", "", []string{CheckInstitution}},
+		{"BREXQQPWXXX", "", []string{CheckCountry}},
+		{"BREXPL-WXXX", "", []string{CheckLocation}},
+		{"BREXPLPWX_X", "", []string{CheckBranch}},
+		{"BREXPLPWXXX", "DE", []string{CheckCountryMatch}},
+		{"12EXQQ-W", "PL", []string{CheckInstitution, CheckCountry, CheckLocation, CheckCountryMatch}},
+		{"1234PL", "", []string{CheckLength, CheckInstitution}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.failed, checks(ValidateBIC(tt.code, tt.iso2)), "code %q, country %q", tt.code, tt.iso2)
+	}
+}
+
+// Tests the messages of a failed code, also joined for a single error.
+func TestValidateBIC_Messages(t *testing.T) {
+	failures := ValidateBIC("BREXPLPW", "DE")
+	assert.Equal(t, []Failure{{
+		Check:   CheckCountryMatch,
+		Message: `country code "PL" (characters 5-6) does not match countryISO2 "DE"`,
+	}}, failures)
+
+	joined := Messages(ValidateBIC("BREX", ""))
+	assert.Equal(t, "must be 8 or 11 characters, got 4", joined)
+	assert.Contains(t, Messages(ValidateBIC("1REXQQPW", "")), "; ")
+}
@@ -10,28 +10,31 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/Mekambee/Swift-Codes-Api/internal/api"
 	"github.com/Mekambee/Swift-Codes-Api/internal/database"
+	"github.com/Mekambee/Swift-Codes-Api/internal/repository"
 	"github.com/Mekambee/Swift-Codes-Api/internal/services"
 )
 
 // Tests GET /v1/swift-codes/{swiftCode} after loading XLSX data into the DB.
 func TestIntegration_GetSwiftCode(t *testing.T) {
-	err := database.ConnectAndMigrate("localhost", "myuser", "mysecretpassword", "swiftdb", "5432")
-	assert.NoError(t, err, "DB connection should succeed")
-	defer database.DB.Close()
+	db, err := database.ConnectAndMigrate("localhost", "myuser", "mysecretpassword", "swiftdb", "5432")
+	require.NoError(t, err, "DB connection should succeed")
+	defer db.Close()
+	service := services.NewSwiftService(repository.NewPostgresRepository(db))
 
-	_, _ = database.DB.Exec("TRUNCATE swift_codes RESTART IDENTITY")
+	_, _ = db.Exec("TRUNCATE swift_codes RESTART IDENTITY")
 
 	testFile := filepath.Join("testdata", "integration_test.xlsx")
 	data, err := services.ParseSwiftXLSX(testFile)
 	assert.NoError(t, err, "Parsing XLSX should succeed")
 
-	err = services.SaveSwiftCodes(data)
+	err = service.SaveSwiftCodes(data)
 	assert.NoError(t, err, "Saving to DB should succeed")
 
-	router := api.SetupRouter()
+	router := api.SetupRouter(service)
 
 	swiftCode := "AIPOPLP1XXX"
 	req, _ := http.NewRequest("GET", "/v1/swift-codes/"+swiftCode, nil)
@@ -60,19 +63,20 @@ func TestIntegration_GetSwiftCode(t *testing.T) {
 
 // Tests GET /v1/swift-codes/country/{countryISO2}.
 func TestIntegration_GetCountry(t *testing.T) {
-	err := database.ConnectAndMigrate("localhost", "myuser", "mysecretpassword", "swiftdb", "5432")
-	assert.NoError(t, err)
-	defer database.DB.Close()
+	db, err := database.ConnectAndMigrate("localhost", "myuser", "mysecretpassword", "swiftdb", "5432")
+	require.NoError(t, err)
+	defer db.Close()
+	service := services.NewSwiftService(repository.NewPostgresRepository(db))
 
-	_, _ = database.DB.Exec("TRUNCATE swift_codes RESTART IDENTITY")
+	_, _ = db.Exec("TRUNCATE swift_codes RESTART IDENTITY")
 
 	testFile := filepath.Join("testdata", "integration_test.xlsx")
 	data, err := services.ParseSwiftXLSX(testFile)
 	assert.NoError(t, err, "Parsing XLSX should succeed")
-	err = services.SaveSwiftCodes(data)
+	err = service.SaveSwiftCodes(data)
 	assert.NoError(t, err, "Saving to DB should succeed")
 
-	router := api.SetupRouter()
+	router := api.SetupRouter(service)
 
 	req, _ := http.NewRequest("GET", "/v1/swift-codes/country/CL", nil)
 	w := httptest.NewRecorder()
@@ -93,13 +97,14 @@ func TestIntegration_GetCountry(t *testing.T) {
 
 // Tests POST /v1/swift-codes/ for creating a new SWIFT code.
 func TestIntegration_PostNewSwiftCode(t *testing.T) {
-	err := database.ConnectAndMigrate("localhost", "myuser", "mysecretpassword", "swiftdb", "5432")
-	assert.NoError(t, err)
-	defer database.DB.Close()
+	db, err := database.ConnectAndMigrate("localhost", "myuser", "mysecretpassword", "swiftdb", "5432")
+	require.NoError(t, err)
+	defer db.Close()
+	service := services.NewSwiftService(repository.NewPostgresRepository(db))
 
-	_, _ = database.DB.Exec("TRUNCATE swift_codes RESTART IDENTITY")
+	_, _ = db.Exec("TRUNCATE swift_codes RESTART IDENTITY")
 
-	router := api.SetupRouter()
+	router := api.SetupRouter(service)
 
 	body := `{
 		"address": "Some address",
@@ -121,7 +126,7 @@ func TestIntegration_PostNewSwiftCode(t *testing.T) {
 	json.Unmarshal(w.Body.Bytes(), &resp)
 	assert.Equal(t, "Swift code created", resp["message"], "Should confirm creation")
 
-	row := database.DB.QueryRow(`
+	row := db.QueryRow(`
 		SELECT swift_code, country_iso2, is_headquarter
 		FROM swift_codes
 		WHERE swift_code = 'TESTUSNYXXX'
@@ -137,18 +142,19 @@ func TestIntegration_PostNewSwiftCode(t *testing.T) {
 
 // Tests DELETE /v1/swift-codes/{swiftCode} with bankName and countryISO2 in the JSON body.
 func TestIntegration_DeleteSwiftCode(t *testing.T) {
-	err := database.ConnectAndMigrate("localhost", "myuser", "mysecretpassword", "swiftdb", "5432")
-	assert.NoError(t, err)
-	defer database.DB.Close()
+	db, err := database.ConnectAndMigrate("localhost", "myuser", "mysecretpassword", "swiftdb", "5432")
+	require.NoError(t, err)
+	defer db.Close()
+	service := services.NewSwiftService(repository.NewPostgresRepository(db))
 
-	_, _ = database.DB.Exec("TRUNCATE swift_codes RESTART IDENTITY")
+	_, _ = db.Exec("TRUNCATE swift_codes RESTART IDENTITY")
 
-	_, _ = database.DB.Exec(`
+	_, _ = db.Exec(`
 		INSERT INTO swift_codes (swift_code, bank_name, address, country_iso2, country_name, is_headquarter)
 		VALUES ('TESTUSNYXXX', 'TEST BANK', 'Some address', 'US', 'UNITED STATES', true)
 	`)
 
-	router := api.SetupRouter()
+	router := api.SetupRouter(service)
 
 	body := `{"bankName":"TEST BANK","countryISO2":"US"}`
 	req, _ := http.NewRequest("DELETE", "/v1/swift-codes/TESTUSNYXXX", strings.NewReader(body))
@@ -162,7 +168,7 @@ func TestIntegration_DeleteSwiftCode(t *testing.T) {
 	json.Unmarshal(w.Body.Bytes(), &resp)
 	assert.Equal(t, "Swift code deleted", resp["message"])
 
-	row := database.DB.QueryRow(`
+	row := db.QueryRow(`
 		SELECT COUNT(*) FROM swift_codes
 		WHERE swift_code = 'TESTUSNYXXX'
 	`)